@@ -0,0 +1,280 @@
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+var (
+	std      = NewApp("", "") // 默认应用(包级函数均作用于它)
+	apps     = []*App{}       // 所有应用(进程退出时逆序关闭)
+	appsLock util.Locker
+)
+
+func init() {
+	util.Term(func(reason interface{}) {
+		defer appsLock.UnLock(appsLock.Lock())
+		for i := len(apps) - 1; i >= 0; i-- {
+			apps[i].shut(fmt.Errorf("%v", reason))
+		}
+	})
+}
+
+// 创建应用(拥有独立的控制器集合, 日志字段与生命周期, 可在同一进程运行多个)
+func NewApp(name, version string) *App {
+	app := &App{
+		info:        appInfo{Name: name, Version: version},
+		controls:    []IControler{},
+		starteds:    []IControler{},
+		checkers:    map[string]IHealthChecker{},
+		shutGrace:   C_SHUT_GRACE_PERIOD,
+		shutBudgets: map[string]time.Duration{},
+	}
+	app.RegHealth("log", THealthFunc(logHealth))
+	app.RegHealth("warmup", THealthFunc(app.warmHealth))
+
+	defer appsLock.UnLock(appsLock.Lock())
+	apps = append(apps, app)
+	return app
+}
+
+// 默认应用
+func Default() *App { return std }
+
+// 所有应用的快照(创建顺序)
+func appList() []*App {
+	defer appsLock.UnLock(appsLock.Lock())
+	return append([]*App{}, apps...)
+}
+
+// > 应用
+type App struct {
+	mutex     util.RWLocker // 保护控制器列表, 检查项, 关闭预算, 钩子列表与钩子上下文(探针与内省在其他协程读取)
+	info      appInfo
+	started   atomic.Bool
+	deferInit bool         // 安装时不立即初始化, 在Start时按依赖顺序统一初始化
+	sharConf  bool         // 控制器由全局配置段构建(热更时通知; 默认应用始终通知)
+	controls  []IControler // 已安装的控制器(安装顺序)
+	starteds  []IControler // 已初始化的控制器(初始化顺序)
+
+	ready    atomic.Bool               // 就绪状态(启动完成后为true, 开始关闭时为false)
+	checkers map[string]IHealthChecker // 非控制器的健康检查项
+
+	shutGrace   time.Duration
+	shutBudgets map[string]time.Duration
+
+	hooksStarted  []*hook
+	hooksStopping []*hook
+	hooksStopped  []*hook
+	hookCtx       context.Context // 异步启动钩子的上下文(关闭时取消)
+	hookCancel    context.CancelFunc
+	warmups       atomic.Int32          // 未完成的预热钩子数量
+	warmErr       atomic.Pointer[error] // 预热钩子的失败(非nil时不就绪, 并在健康检查中报告)
+}
+
+// 应用名称
+func (this *App) Name() string { return this.info.Name }
+
+// 应用版本
+func (this *App) Version() string { return this.info.Version }
+
+// 环境变量前缀(Name大写, 非字母数字替换为'_')
+func (this *App) EnvPrefix() string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, this.info.Name)
+}
+
+// 控制器日志(非默认应用附加app字段)
+func (this *App) Logger(name string) log.ILoger {
+	if this == std {
+		return log.Field("ctrl", name)
+	}
+	return log.Fields(map[string]interface{}{"app": this.info.Name, "ctrl": name})
+}
+
+// 延迟初始化(安装时只登记, Start时按依赖顺序统一初始化, 失败则回滚并返回错误; 需在Install之前调用)
+func (this *App) DeferInit() *App {
+	this.deferInit = true
+	return this
+}
+
+// 创建属于本应用的定时器(分布式锁以应用名区分服务)
+func (this *App) Timer() ITimer { return &timer{app: this} }
+
+// 控制器由全局配置段构建(配置热更时通知本应用的控制器; 否则配置全局唯一, 仅通知默认应用; 需在Start之前调用)
+func (this *App) ShareConf() *App {
+	this.sharConf = true
+	return this
+}
+
+// 安装控制器(默认立即初始化, 依赖尚未安装的则等待依赖安装后再初始化; DeferInit时在Start中初始化)
+func (this *App) Install(ctrl IControler) IControler {
+	if this.Controler(ctrl.HandleName()) != nil {
+		log.Fatal("Control[%v] was already existed.", ctrl.HandleName())
+	}
+	if b, ok := ctrl.(IAppBinder); ok {
+		b.HandleApp(this)
+	}
+
+	func() { defer this.mutex.UnLock(this.mutex.Lock()); this.controls = append(this.controls, ctrl) }()
+	if started := this.started.Load(); started || !this.deferInit {
+		if err := this.startup(!started); err != nil {
+			log.Fatal("Install control[%v] err:%v", ctrl.HandleName(), err)
+		}
+	}
+	return ctrl
+}
+
+// 获取控制器(名称不区分大小写, 与配置段名一致)
+func (this *App) Controler(name string) IControler {
+	for _, it := range this.controlList() {
+		if strings.EqualFold(it.HandleName(), name) {
+			return it
+		}
+	}
+	return nil
+}
+
+// 启动(按依赖顺序初始化所有已安装的控制器并执行启动钩子, 失败则逆序销毁已初始化的控制器并返回错误)
+func (this *App) Start() error {
+	err := this.startup(false)
+	if err == nil {
+		hooks := func() []*hook { // 与OnStarted互斥: 之前注册的在此执行, 之后注册的立即执行
+			defer this.mutex.UnLock(this.mutex.Lock())
+			this.started.Store(true)
+			return append([]*hook{}, this.hooksStarted...)
+		}()
+		this.warmErr.Store(nil)
+		if err = this.runStarted(hooks); err != nil {
+			this.started.Store(false)
+			this.runStopHooks(nil)
+		}
+	}
+	if err != nil {
+		log.Error("Start controls err:%v, rollback controls(%d)...", err, len(this.startedList()))
+		return errors.Join(append([]error{err}, this.terminate()...)...)
+	}
+	return nil
+}
+
+// 停止(执行关闭钩子, 逆序销毁所有已初始化的控制器, 不退出进程)
+func (this *App) Stop() error {
+	util.Cast(this == std, unwatch, nil)
+	this.started.Store(false)
+	this.ready.Store(false)
+	this.runStopHooks(this.hookList(&this.hooksStopping))
+	errs := this.terminate()
+	this.runStopHooks(this.hookList(&this.hooksStopped))
+	return errors.Join(errs...)
+}
+
+// 等待进程结束(未启动则先启动; 因致命错误关闭时以非零码退出)
+func (this *App) Wait() {
+	if !this.started.Load() {
+		if err := this.Start(); err != nil {
+			log.Fatal("Start controls err:%v", err)
+		}
+	}
+
+	log.InfoD(-1, "[app_name:%q exe_name:%q app_ver:%s] Start Work...", this.Name(), util.ExeName(), this.Version())
+
+	if code := util.Wait(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// ======================================== [internal]
+
+// 初始化尚未初始化的控制器(拓扑序; partial:依赖未满足的继续等待)
+func (this *App) startup(partial bool) error {
+	orders, err := sortDepends(this.controlList(), this.startedList(), partial)
+	if err != nil {
+		return err
+	}
+	for _, it := range orders {
+		if err := initControl(it); err != nil {
+			return fmt.Errorf("control[%s] init err:%w", it.HandleName(), err)
+		}
+		func() { defer this.mutex.UnLock(this.mutex.Lock()); this.starteds = append(this.starteds, it) }()
+	}
+	return nil
+}
+
+// 停止所有已初始化的控制器
+func (this *App) shut(reason error) {
+	starteds := this.startedList()
+	if len(starteds) == 0 {
+		return
+	}
+	log.InfoD(-1, "Start Shut Controls(%d)... by reason: %q", len(starteds), reason)
+	defer log.InfoD(-1, "[app_name:%q exe_name:%q app_ver:%s] Shut Done.", this.Name(), util.ExeName(), this.Version())
+
+	util.Cast(this == std, unwatch, nil)
+	this.started.Store(false)
+	this.ready.Store(false)
+	this.runStopHooks(this.hookList(&this.hooksStopping))
+	for _, err := range this.terminate() {
+		log.ErrorD(-1, "Shut controls err:%v", err)
+	}
+	this.runStopHooks(this.hookList(&this.hooksStopped))
+}
+
+// 已初始化的控制器
+func (this *App) startedControl(name string) IControler {
+	for _, it := range this.startedList() {
+		if strings.EqualFold(it.HandleName(), name) {
+			return it
+		}
+	}
+	return nil
+}
+
+// 已安装的控制器(快照)
+func (this *App) controlList() []IControler {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+	return append([]IControler{}, this.controls...)
+}
+
+// 已初始化的控制器(快照)
+func (this *App) startedList() []IControler {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+	return append([]IControler{}, this.starteds...)
+}
+
+// 初始化单个控制器(panic转为错误)
+func initControl(ctrl IControler) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("panic: %v", x)
+		}
+	}()
+
+	if c, ok := ctrl.(IControlerE); ok {
+		return c.HandleInitE()
+	}
+	ctrl.HandleInit()
+	return nil
+}
+
+// ==================== AppBind
+
+// > 控制器可嵌入的应用绑定(实现IAppBinder, 未绑定时为默认应用)
+type AppBind struct{ app *App }
+
+func (b *AppBind) HandleApp(app *App) { b.app = app }
+
+// 所属应用
+func (b *AppBind) App() *App { return util.Tern(b.app != nil, b.app, std) }
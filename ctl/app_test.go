@@ -0,0 +1,102 @@
+package ctl
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudapex/ulib/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(&log.Config{Level: log.ELL_Warns})
+	code := m.Run()
+	log.Term()
+	os.Exit(code)
+}
+
+type testCtrl struct {
+	name    string
+	deps    []string
+	initErr error
+	events  *[]string
+}
+
+func (c *testCtrl) HandleName() string      { return c.name }
+func (c *testCtrl) HandleDepends() []string { return c.deps }
+func (c *testCtrl) HandleInit()             {}
+func (c *testCtrl) HandleInitE() error {
+	*c.events = append(*c.events, "init:"+c.name)
+	return c.initErr
+}
+func (c *testCtrl) HandleTerm() { *c.events = append(*c.events, "term:"+c.name) }
+
+func TestInstallEager(t *testing.T) {
+	events := []string{}
+	app := NewApp("eager", "1.0.0")
+
+	app.Install(&testCtrl{name: "a", events: &events})
+	if got := strings.Join(events, ","); got != "init:a" {
+		t.Fatalf("install should init at once, got %q", got)
+	}
+
+	// 依赖尚未安装: 等待依赖安装后再按序初始化
+	app.Install(&testCtrl{name: "c", deps: []string{"b"}, events: &events})
+	app.Install(&testCtrl{name: "b", deps: []string{"a"}, events: &events})
+	if got := strings.Join(events, ","); got != "init:a,init:b,init:c" {
+		t.Fatalf("unexpected init order %q", got)
+	}
+
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(events[3:], ","); got != "term:c,term:b,term:a" {
+		t.Fatalf("unexpected term order %q", got)
+	}
+}
+
+func TestInstallMissingDepend(t *testing.T) {
+	events := []string{}
+	app := NewApp("missing", "1.0.0")
+	app.Install(&testCtrl{name: "evn", deps: []string{"rdb"}, events: &events})
+	if len(events) != 0 {
+		t.Fatalf("control with missing depend should wait, got %v", events)
+	}
+	err := app.Start()
+	if err == nil || !strings.Contains(err.Error(), "depends on [rdb] which is not installed") {
+		t.Fatalf("expect missing depend err, got %v", err)
+	}
+}
+
+func TestDeferInitRollback(t *testing.T) {
+	events := []string{}
+	app := NewApp("deferred", "1.0.0").DeferInit()
+	app.Install(&testCtrl{name: "b", deps: []string{"a"}, events: &events})
+	app.Install(&testCtrl{name: "a", events: &events})
+	app.Install(&testCtrl{name: "c", deps: []string{"b"}, initErr: errors.New("boom"), events: &events})
+	if len(events) != 0 {
+		t.Fatalf("deferred install should not init, got %v", events)
+	}
+
+	err := app.Start()
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect init err, got %v", err)
+	}
+	if got := strings.Join(events, ","); got != "init:a,init:b,init:c,term:b,term:a" {
+		t.Fatalf("unexpected lifecycle %q", got)
+	}
+}
+
+func TestDependsCycle(t *testing.T) {
+	events := []string{}
+	app := NewApp("cycle", "1.0.0").DeferInit()
+	app.Install(&testCtrl{name: "a", deps: []string{"b"}, events: &events})
+	app.Install(&testCtrl{name: "b", deps: []string{"a"}, events: &events})
+	if err := app.Start(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expect cycle err, got %v", err)
+	}
+}
@@ -0,0 +1,433 @@
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cloudapex/ulib/util"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	confFile string   // --config
+	confSets []string // --set
+
+	conf     = &config{tree: map[string]interface{}{}}
+	confLock util.RWLocker
+	validate = newValidator()
+)
+
+// 加载配置(文件 < 环境变量 < 命令行), Init时根据 --config 自动加载
+//
+//	文件: 根据后缀(.json .yaml .yml .toml)解析
+//	环境变量: {envPrefix}__{SECTION}__{KEY}, 数组使用下标, 如 APP__RDB__0__ADDR
+//	命令行: --set section.key=value, 如 --set rdb.0.addr=127.0.0.1:6379
+func LoadConfig(file, envPrefix string) error {
+	c, err := loadConfig(file, envPrefix, confSets)
+	if err != nil {
+		return err
+	}
+	setCurrent(c)
+	return nil
+}
+
+// 配置文件路径
+func ConfigFile() string { return current().file }
+
+// 解析指定配置段到out(依据json tag), 并进行 validate tag 校验
+func Section(name string, out interface{}) error { return current().section(name, out) }
+
+// 解析指定配置段(泛型)
+func Conf[T any](name string) (*T, error) {
+	out := new(T)
+	if err := Section(name, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// > 配置段(热更时传递)
+type ConfSection struct {
+	Name  string
+	node  interface{}
+	exist bool
+}
+
+// 配置段是否存在
+func (s *ConfSection) Exist() bool { return s.exist }
+
+// 解析配置段到out
+func (s *ConfSection) Decode(out interface{}) error {
+	if !s.exist {
+		return fmt.Errorf("config[%s] %w", s.Name, ErrSectionNotFound)
+	}
+	return decodeNode(s.Name, s.node, out)
+}
+
+// ======================================== [internal]
+
+// 当前配置
+func current() *config {
+	defer confLock.RUnLock(confLock.RLock())
+	return conf
+}
+
+func setCurrent(c *config) {
+	defer confLock.UnLock(confLock.Lock())
+	conf = c
+}
+
+// 注册配置相关命令行参数(已被业务定义的则跳过)
+func confFlags() {
+	if pflag.Lookup("config") == nil {
+		short := util.Tern(pflag.ShorthandLookup("c") == nil, "c", "")
+		pflag.StringVarP(&confFile, "config", short, "", "config file path(json|yaml|toml)")
+	}
+	if pflag.Lookup("set") == nil {
+		pflag.StringArrayVar(&confSets, "set", nil, "override config value, eg: --set htp.listenAddr=:8080")
+	}
+}
+
+// 配置数据
+type config struct {
+	file      string
+	envPrefix string
+	tree      map[string]interface{}
+}
+
+func loadConfig(file, envPrefix string, sets []string) (*config, error) {
+	c := &config{file: file, envPrefix: envPrefix, tree: map[string]interface{}{}}
+
+	// 1. 文件
+	if file != "" {
+		tree, err := parseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c.tree = tree
+	}
+
+	// 2. 环境变量
+	if envPrefix != "" {
+		prefix := strings.ToUpper(envPrefix) + "__"
+		for _, kv := range os.Environ() {
+			key, val, _ := strings.Cut(kv, "=")
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if err := c.set(strings.Split(strings.TrimPrefix(key, prefix), "__"), val); err != nil {
+				return nil, fmt.Errorf("config env[%s] %v", key, err)
+			}
+		}
+	}
+
+	// 3. 命令行
+	for _, kv := range sets {
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("config flag --set %q invalid, expect key.path=value", kv)
+		}
+		if err := c.set(strings.Split(key, "."), val); err != nil {
+			return nil, fmt.Errorf("config flag[%s] %v", key, err)
+		}
+	}
+	return c, nil
+}
+
+// 解析配置文件为通用结构
+func parseFile(file string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("config file read err:%v", err)
+	}
+
+	tree := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &tree)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file ext %q not supported", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %q parse err:%v", file, err)
+	}
+	return tree, nil
+}
+
+// 按路径覆盖配置值(键名不区分大小写, 值类型参照原值)
+func (c *config) set(path []string, val string) error {
+	var node interface{} = c.tree
+	for i, seg := range path {
+		last := i == len(path)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			key := seg
+			for k := range n {
+				if strings.EqualFold(k, seg) {
+					key = k
+					break
+				}
+			}
+			if last {
+				n[key] = parseValue(n[key], val)
+				return nil
+			}
+			if _, ok := n[key]; !ok {
+				n[key] = util.Tern[bool, interface{}](isIndex(path[i+1]), []interface{}{}, map[string]interface{}{})
+			}
+			node = n[key]
+			if arr, ok := node.([]interface{}); ok && isIndex(path[i+1]) {
+				idx, _ := strconv.Atoi(path[i+1])
+				if idx >= len(arr) { // 扩展数组后回写
+					arr = append(arr, make([]interface{}, idx-len(arr)+1)...)
+					n[key], node = arr, arr
+				}
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return fmt.Errorf("path %q index invalid", strings.Join(path[:i+1], "."))
+			}
+			if last {
+				n[idx] = parseValue(n[idx], val)
+				return nil
+			}
+			if n[idx] == nil {
+				n[idx] = map[string]interface{}{}
+			}
+			node = n[idx]
+		default:
+			return fmt.Errorf("path %q is not a section", strings.Join(path[:i], "."))
+		}
+	}
+	return nil
+}
+
+// 查找配置段节点
+func (c *config) node(name string) (interface{}, bool) {
+	var node interface{} = c.tree
+	for _, seg := range strings.Split(name, ".") {
+		found := false
+		switch n := node.(type) {
+		case map[string]interface{}:
+			for k, v := range n {
+				if strings.EqualFold(k, seg) {
+					node, found = v, true
+					break
+				}
+			}
+		case []interface{}:
+			if idx, err := strconv.Atoi(seg); err == nil && idx >= 0 && idx < len(n) {
+				node, found = n[idx], true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// 解析配置段
+func (c *config) section(name string, out interface{}) error {
+	node, ok := c.node(name)
+	if !ok {
+		return fmt.Errorf("config[%s] %w", name, ErrSectionNotFound)
+	}
+	return decodeNode(name, node, out)
+}
+
+// 解析节点到out并校验
+func decodeNode(name string, node interface{}, out interface{}) error {
+	data, err := json.Marshal(resolve(node, reflect.TypeOf(out)))
+	if err != nil {
+		return fmt.Errorf("config[%s] %v", name, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		var e *json.UnmarshalTypeError
+		if errors.As(err, &e) {
+			return fmt.Errorf("config[%s.%s] expect %v but got %s", name, e.Field, e.Type, e.Value)
+		}
+		return fmt.Errorf("config[%s] %v", name, err)
+	}
+	return validStruct(name, out)
+}
+
+// 校验配置结构(支持struct与slice/map of struct)
+func validStruct(name string, out interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(out))
+	switch v.Kind() {
+	case reflect.Struct:
+		return validErr(name, validate.Struct(out))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validStruct(fmt.Sprintf("%s.%d", name, i), v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if err := validStruct(fmt.Sprintf("%s.%v", name, k), v.MapIndex(k).Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func validErr(name string, err error) error {
+	var ve validator.ValidationErrors
+	if !errors.As(err, &ve) || len(ve) == 0 {
+		return err
+	}
+	errs := make([]error, 0, len(ve))
+	for _, e := range ve { // Namespace: Struct.field.sub
+		path := name
+		if _, sub, ok := strings.Cut(e.Namespace(), "."); ok {
+			path += "." + sub
+		}
+		errs = append(errs, fmt.Errorf("config[%s] invalid by tag %q(%s)", path, e.Tag(), e.Param()))
+	}
+	return errors.Join(errs...)
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		return util.Tern(name == "" || name == "-", f.Name, name)
+	})
+	return v
+}
+
+// 参照原值类型解析字符串(原值不存在时保留原文, 解析时按目标字段类型转换)
+func parseValue(old interface{}, val string) interface{} {
+	switch old.(type) {
+	case nil:
+		return rawValue(val)
+	case string:
+		return val
+	case bool:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	case float64, int, int64, uint64:
+		if n, err := strconv.ParseFloat(val, 64); err == nil {
+			return n
+		}
+	}
+	return guessValue(val)
+}
+
+// 按json猜测类型(失败则为字符串)
+func guessValue(val string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(val), &v); err == nil {
+		return v
+	}
+	return val
+}
+
+// > 环境变量/命令行设置的新键(文件中不存在, 类型待定)
+type rawValue string
+
+// 按目标类型转换节点中的rawValue(不修改原节点)
+func resolve(node interface{}, typ reflect.Type) interface{} {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch n := node.(type) {
+	case rawValue:
+		return rawTyped(string(n), typ)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			m[k] = resolve(v, fieldType(typ, k))
+		}
+		return m
+	case []interface{}:
+		var elem reflect.Type
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			elem = typ.Elem()
+		}
+		l := make([]interface{}, len(n))
+		for i, v := range n {
+			l[i] = resolve(v, elem)
+		}
+		return l
+	}
+	return node
+}
+
+// 按目标类型解析字符串(未知类型按json猜测)
+func rawTyped(val string, typ reflect.Type) interface{} {
+	if typ == nil {
+		return guessValue(val)
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return val
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+		return val
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(val, 64); err == nil {
+			return n
+		}
+		return val
+	}
+	return guessValue(val)
+}
+
+// 结构字段(按json tag, 不区分大小写, 含匿名嵌入)或map元素的类型
+func fieldType(typ reflect.Type, key string) reflect.Type {
+	if typ == nil {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Map:
+		return typ.Elem()
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				for ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if t := fieldType(ft, key); t != nil {
+					return t
+				}
+				continue
+			}
+			if strings.EqualFold(util.Tern(name == "", f.Name, name), key) {
+				return f.Type
+			}
+		}
+	}
+	return nil
+}
+func isIndex(seg string) bool {
+	_, err := strconv.Atoi(seg)
+	return err == nil
+}
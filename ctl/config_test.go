@@ -0,0 +1,141 @@
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testDbConf struct {
+	Addr string `json:"addr" validate:"required"`
+	Pass string `json:"pass"`
+	Port int    `json:"port" validate:"min=1"`
+	Tls  bool   `json:"tls"`
+	Size int    `json:"size" validate:"max=10"`
+}
+
+func TestConfigOverrideByFieldType(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.json")
+	if err := os.WriteFile(file, []byte(`{"db":{"addr":"127.0.0.1"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TESTAPP__DB__PASS", "123456")
+	t.Setenv("TESTAPP__DB__PORT", "3306")
+	c, err := loadConfig(file, "testapp", []string{"db.tls=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf testDbConf
+	if err := c.section("db", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Pass != "123456" || conf.Port != 3306 || !conf.Tls {
+		t.Fatalf("unexpected conf %+v", conf)
+	}
+}
+
+func TestConfigValidJoinErrors(t *testing.T) {
+	c, err := loadConfig("", "", []string{"db.size=20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf testDbConf
+	err = c.section("db", &conf)
+	if err == nil {
+		t.Fatal("expect validation error")
+	}
+	for _, path := range []string{"db.addr", "db.port", "db.size"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Fatalf("error %q missing %s", err, path)
+		}
+	}
+}
+
+func TestReloadCommitsPerSection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.json")
+	if err := os.WriteFile(file, []byte(`{"bad":{"v":1},"good":{"v":1},"warn":{"v":1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := current()
+	defer setCurrent(old)
+	if err := LoadConfig(file, ""); err != nil {
+		t.Fatal(err)
+	}
+	RegReload("bad", TReloadFunc(func(old, new *ConfSection) error { return errors.New("refused") }))
+	RegReload("good", TReloadFunc(func(old, new *ConfSection) error { return nil }))
+	RegReload("warn", TReloadFunc(func(old, new *ConfSection) error {
+		return fmt.Errorf("config[v] can not be reloaded: %w", ErrRestartOnly)
+	}))
+	defer func() {
+		defer reloadLock.UnLock(reloadLock.Lock())
+		delete(reloaders, "bad")
+		delete(reloaders, "good")
+		delete(reloaders, "warn")
+	}()
+
+	if err := os.WriteFile(file, []byte(`{"bad":{"v":2},"good":{"v":2},"warn":{"v":2}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := Reload()
+	if err == nil || !strings.Contains(err.Error(), "config[bad]") {
+		t.Fatalf("expect reload error of bad, got %v", err)
+	}
+	if strings.Contains(err.Error(), "config[warn]") {
+		t.Fatalf("restart only should not be reported as failure: %v", err)
+	}
+	for name, v := range map[string]int{"bad": 1, "good": 2, "warn": 2} {
+		conf, err := Conf[struct{ V int }](name)
+		if err != nil || conf.V != v {
+			t.Fatalf("config[%s] should be v%d, got %+v err:%v", name, v, conf, err)
+		}
+	}
+
+	// 失败的配置段保留旧值, 下次热更时重试
+	if err := os.WriteFile(file, []byte(`{"good":{"v":2},"warn":{"v":2}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	RegReload("bad", TReloadFunc(func(old, new *ConfSection) error { return nil }))
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Conf[struct{ V int }]("bad"); !errors.Is(err, ErrSectionNotFound) {
+		t.Fatalf("config[bad] should be removed, got err:%v", err)
+	}
+}
+
+type reloadCtrl struct {
+	testCtrl
+	calls int
+}
+
+func (c *reloadCtrl) HandleReload(old, new *ConfSection) error { c.calls++; return nil }
+
+func TestReloadSkipsOwnConfApp(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.json")
+	if err := os.WriteFile(file, []byte(`{"shared":{"v":1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := current()
+	defer setCurrent(old)
+	if err := LoadConfig(file, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	events := []string{}
+	own, shared := &reloadCtrl{testCtrl: testCtrl{name: "shared", events: &events}}, &reloadCtrl{testCtrl: testCtrl{name: "shared", events: &events}}
+	NewApp("own-conf", "").Install(own)
+	NewApp("shared-conf", "").ShareConf().Install(shared)
+
+	if err := os.WriteFile(file, []byte(`{"shared":{"v":2}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if own.calls != 0 || shared.calls != 1 {
+		t.Fatalf("only ShareConf app should be notified, got own:%d shared:%d", own.calls, shared.calls)
+	}
+}
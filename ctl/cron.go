@@ -0,0 +1,269 @@
+package ctl
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+// ==================== schedule(计算下次执行时间)
+type schedule interface {
+	next(last, now time.Time) time.Time
+	String() string
+}
+
+// 固定间隔
+type everySchedule struct {
+	interval time.Duration
+	align    bool // 按间隔边界对齐(多副本互斥时各副本触发时间一致)
+}
+
+func (s *everySchedule) String() string { return "@every " + s.interval.String() }
+func (s *everySchedule) next(last, now time.Time) time.Time {
+	if last.IsZero() {
+		return now
+	}
+	if s.align {
+		return last.Truncate(s.interval).Add(s.interval)
+	}
+	return last.Add(s.interval)
+}
+
+// 每天一次(after0:每天超过零点多少时间; last为零值表示当天时间满足即执行, 否则从次日开始)
+type dailySchedule struct {
+	after0 time.Duration
+	loc    *time.Location
+}
+
+func (s *dailySchedule) String() string { return fmt.Sprintf("@daily+%v %s", s.after0, s.loc) }
+func (s *dailySchedule) next(last, now time.Time) time.Time {
+	if last.IsZero() {
+		y, m, d := now.In(s.loc).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, s.loc).Add(s.after0)
+	}
+	y, m, d := last.In(s.loc).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, s.loc).Add(s.after0)
+}
+
+// cron表达式
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool
+	loc                                   *time.Location
+	spec                                  string
+}
+
+func (s *cronSchedule) String() string { return s.spec }
+
+func (s *cronSchedule) next(last, now time.Time) time.Time {
+	from := last
+	if from.IsZero() || from.Before(now) {
+		from = now
+	}
+	t := from.In(s.loc).Add(time.Second - time.Duration(from.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+	for 1<<uint(t.Month())&s.month == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+	for !s.dayMatch(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+	for 1<<uint(t.Second())&s.second == 0 {
+		t = t.Truncate(time.Second).Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+	return t
+}
+
+// 日与周: 两者都有限定时满足其一即可, 否则需同时满足
+func (s *cronSchedule) dayMatch(t time.Time) bool {
+	domOk := 1<<uint(t.Day())&s.dom != 0
+	dowOk := 1<<uint(t.Weekday())&s.dow != 0
+	if s.domStar || s.dowStar {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// ==================== parse
+
+type cronBounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	cronSeconds = cronBounds{0, 59, nil}
+	cronMinutes = cronBounds{0, 59, nil}
+	cronHours   = cronBounds{0, 23, nil}
+	cronDoms    = cronBounds{1, 31, nil}
+	cronMonths  = cronBounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDows = cronBounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// 解析cron表达式
+//
+//	[CRON_TZ=时区] [秒] 分 时 日 月 周
+//	支持: * ? a-b */n a-b/n a/n 列表(,) 月与周的英文缩写
+//	宏: @yearly @monthly @weekly @daily @hourly @every <duration>
+func parseCron(spec string, loc *time.Location) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if loc == nil {
+		loc = time.Local
+	}
+
+	// 时区
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(tz, "=")
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q time zone err:%v", spec, err)
+		}
+		spec, loc = strings.TrimSpace(rest), l
+	}
+
+	// 宏
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("cron %q invalid @every duration", spec)
+		}
+		return &everySchedule{interval: d}, nil
+	}
+	if m, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron %q expect 5 or 6 fields but got %d", spec, len(fields))
+	}
+
+	s := &cronSchedule{loc: loc, spec: fmt.Sprintf("%s %s", strings.Join(fields, " "), loc)}
+	var err error
+	for i, it := range []struct {
+		name   string
+		bits   *uint64
+		bounds cronBounds
+	}{
+		{"second", &s.second, cronSeconds}, {"minute", &s.minute, cronMinutes}, {"hour", &s.hour, cronHours},
+		{"dom", &s.dom, cronDoms}, {"month", &s.month, cronMonths}, {"dow", &s.dow, cronDows},
+	} {
+		if *it.bits, err = parseCronField(fields[i], it.bounds); err != nil {
+			return nil, fmt.Errorf("cron %q field %s %v", spec, it.name, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 { // 7 也表示周日
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = fields[3] == "*" || fields[3] == "?"
+	s.dowStar = fields[5] == "*" || fields[5] == "?"
+	if bits.OnesCount64(s.dom) == 0 || bits.OnesCount64(s.month) == 0 {
+		return nil, fmt.Errorf("cron %q never fires", spec)
+	}
+	return s, nil
+}
+
+func parseCronField(field string, b cronBounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		lo, hi, step := b.min, b.max, uint(1)
+
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, z, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseCronValue(a, b); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(z, b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseCronValue(rng, b)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, util.Tern(hasStep, b.max, v) // a/n 表示从a开始到最大值
+		}
+		if hasStep {
+			n, err := strconv.ParseUint(stepStr, 10, 32)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = uint(n)
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseCronValue(s string, b cronBounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("value %q out of range [%d,%d]", s, b.min, b.max)
+	}
+	return uint(n), nil
+}
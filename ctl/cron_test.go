@@ -0,0 +1,90 @@
+package ctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.DateTime, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, c := range []struct {
+		spec, from, want string
+	}{
+		{"0 30 9 * * mon-fri", "2024-06-01 10:00:00", "2024-06-03 09:30:00"},                // 周六之后的第一个工作日
+		{"*/15 * * * *", "2024-06-01 10:07:30", "2024-06-01 10:15:00"},                      // 5段: 秒为0
+		{"5/20 * * * * *", "2024-06-01 10:00:06", "2024-06-01 10:00:25"},                    // a/n
+		{"0 0 0 1,15 * *", "2024-06-02 00:00:00", "2024-06-15 00:00:00"},                    // 列表
+		{"0 0 12 * * 7", "2024-06-01 13:00:00", "2024-06-02 12:00:00"},                      // 7为周日
+		{"0 0 0 13 * fri", "2024-06-01 00:00:00", "2024-06-07 00:00:00"},                    // 日与周都限定时满足其一
+		{"0 0 0 29 feb ?", "2025-01-01 00:00:00", "2028-02-29 00:00:00"},                    // 闰日
+		{"@daily", "2024-06-01 10:00:00", "2024-06-02 00:00:00"},                            // 宏
+		{"@hourly", "2024-12-31 23:00:00", "2025-01-01 00:00:00"},                           // 跨年
+		{"0 0 0 * * *", "2024-06-01 00:00:00", "2024-06-02 00:00:00"},                       // 当前时刻不重复触发
+		{"CRON_TZ=Asia/Shanghai 0 0 8 * * *", "2024-06-01 01:00:00", "2024-06-02 00:00:00"}, // 时区
+	} {
+		s, err := parseCron(c.spec, time.UTC)
+		if err != nil {
+			t.Errorf("parse %q err:%v", c.spec, err)
+			continue
+		}
+		if got := s.next(time.Time{}, at(c.from)); !got.Equal(at(c.want)) {
+			t.Errorf("%q next from %s = %v, want %s", c.spec, c.from, got.UTC(), c.want)
+		}
+	}
+}
+
+// last晚于now时从last开始计算; 永不满足的返回零值
+func TestCronNextFromLast(t *testing.T) {
+	s, _ := parseCron("0 0 * * * *", time.UTC)
+	now := time.Date(2024, 6, 1, 10, 20, 0, 0, time.UTC)
+	if got, want := s.next(now.Add(2*time.Hour), now), time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("next from last = %v, want %v", got, want)
+	}
+	s, err := parseCron("0 0 0 31 feb *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.next(time.Time{}, now); !got.IsZero() {
+		t.Fatalf("impossible date should never fire, got %v", got)
+	}
+}
+
+func TestCronEvery(t *testing.T) {
+	s, err := parseCron("@every 90s", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	if got := s.next(time.Time{}, now); !got.Equal(now) {
+		t.Fatalf("first run should be now, got %v", got)
+	}
+	if got := s.next(now, now); !got.Equal(now.Add(90 * time.Second)) {
+		t.Fatalf("next = %v, want +90s", got)
+	}
+}
+
+func TestCronParseErr(t *testing.T) {
+	for _, spec := range []string{
+		"* * * *",                      // 段数不足
+		"* * * * * * *",                // 段数过多
+		"61 * * * * *",                 // 秒越界
+		"* * * * 13 *",                 // 月越界
+		"* * * * * 8",                  // 周越界
+		"*/0 * * * *",                  // 步长为0
+		"5-1 * * * *",                  // 反向区间
+		"abc * * * *",                  // 非法值
+		"@every 10ms",                  // 小于1秒
+		"@every x",                     // 非法时长
+		"CRON_TZ=Nowhere/City * * * *", // 非法时区
+	} {
+		if _, err := parseCron(spec, time.UTC); err == nil {
+			t.Errorf("parse %q should fail", spec)
+		}
+	}
+}
@@ -1,9 +1,32 @@
 package ctl
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudapex/ulib/log"
+)
 
 const (
-	C_TIMER_TICK_INTERVAL = 1 * time.Minute // 定时器默认tick精度
+	C_TIMER_TICK_INTERVAL  = 1 * time.Minute        // 定时器默认最长休眠时间(按任务的下次执行时间唤醒)
+	C_TIMER_LOCK_TTL_MIN   = 500 * time.Millisecond // 定时器分布式锁最短有效期
+	C_TIMER_LOCK_TTL_MAX   = 24 * time.Hour         // 定时器分布式锁最长有效期
+	C_TIMER_RECORD_SIZE    = 128                    // 定时器保留的最近执行记录数量
+	C_TIMER_RETRY_DELAY    = 1 * time.Second        // 定时任务失败重试的初始退避时间
+	C_TIMER_RETRY_MAX      = 10 * time.Minute       // 定时任务失败重试的最长退避时间
+	C_TIMER_CLOSE_TIME_OUT = 10 * time.Second       // 定时器关闭时等待执行中任务的最长时间
+	C_SHUT_GRACE_PERIOD    = 10 * time.Second       // 默认优雅关闭的总宽限时间
+	C_SHUT_MIN_BUDGET      = 500 * time.Millisecond // 总宽限时间耗尽后每个控制器仍可获得的销毁时间
+	C_HEALTH_TIME_OUT      = 3 * time.Second        // 健康检查超时
+	C_CONF_WATCH_INTERVAL  = 5 * time.Second        // 配置文件变更检测间隔
+	C_EXIT_CODE_FATAL      = 1                      // 致命错误导致关闭时的退出码
+)
+
+var (
+	ErrSectionNotFound = errors.New("section not found")
+	ErrRestartOnly     = log.ErrRestartOnly // 热更时仅需重启才能生效的配置项(IReloader以%w包装返回, 作为警告报告)
 )
 
 // > IControl接口
@@ -19,6 +42,112 @@ type IControler interface {
 	HandleTerm()
 }
 
+// > IControl扩展接口(初始化返回错误)
+type IControlerE interface {
+	IControler
+
+	// 控制器准备(实现此接口时代替HandleInit被调用)
+	HandleInitE() error
+}
+
+// > IControl扩展接口(带超时上下文的销毁)
+type IControlerC interface {
+	IControler
+
+	// 控制器销毁(实现此接口时代替HandleTerm被调用, 应在ctx到期前返回)
+	HandleTermC(ctx context.Context) error
+}
+
+// > IControl扩展接口(声明依赖)
+type IDepender interface {
+
+	// 依赖的控制器名称(先于自身初始化,后于自身销毁)
+	HandleDepends() []string
+}
+
+// > IControl扩展接口(健康检查)
+type IHealthChecker interface {
+
+	// 健康检查(返回nil表示健康, detail为附加描述)
+	HandleHealth(ctx context.Context) (detail string, err error)
+}
+
+// > 健康检查函数
+type THealthFunc func(ctx context.Context) (detail string, err error)
+
+func (f THealthFunc) HandleHealth(ctx context.Context) (string, error) { return f(ctx) }
+
+// > 单项健康状态
+type HealthItem struct {
+	Name    string        `json:"name"`
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Detail  string        `json:"detail,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// > 健康报告
+type HealthReport struct {
+	Healthy bool          `json:"healthy"` // 所有检查项均健康
+	Ready   bool          `json:"ready"`   // 已启动, 预热完成且未开始关闭
+	Items   []*HealthItem `json:"items"`
+}
+
+// > IControl扩展接口(配置热更, 配置段名与控制器名相同)
+type IReloader interface {
+
+	// 配置段变更(仅需重启生效的项以ErrRestartOnly包装返回, 作为警告报告; 其它错误视为热更失败, 该配置段保留旧值)
+	HandleReload(old, new *ConfSection) error
+}
+
+// > 配置热更函数
+type TReloadFunc func(old, new *ConfSection) error
+
+func (f TReloadFunc) HandleReload(old, new *ConfSection) error { return f(old, new) }
+
+// > IControl扩展接口(绑定所属应用, 可嵌入AppBind实现)
+type IAppBinder interface {
+
+	// 安装到应用时调用
+	HandleApp(app *App)
+}
+
+// > IControl扩展接口(运行时内省)
+type IInspector interface {
+
+	// 运行时信息(作为快照中该控制器的Detail, 需可json序列化)
+	HandleInspect() interface{}
+}
+
+// > 运行时快照
+type Snapshot struct {
+	App      string         `json:"app"`
+	Version  string         `json:"version"`
+	StartAt  time.Time      `json:"startAt"`
+	Uptime   string         `json:"uptime"`
+	Ready    bool           `json:"ready"`
+	Controls []*ControlInfo `json:"controls"` // 安装顺序
+	Timers   []*TimerJob    `json:"timers"`
+}
+
+// > 控制器信息
+type ControlInfo struct {
+	Name    string      `json:"name"`
+	Depends []string    `json:"depends,omitempty"`
+	Started bool        `json:"started"`
+	Detail  interface{} `json:"detail,omitempty"` // IInspector
+}
+
+// > 生命周期钩子函数
+type THookFunc func(ctx context.Context) error
+
+// > 启动钩子选项
+type HookOpt struct {
+	Name   string // 名称(默认为函数名)
+	Async  bool   // 是否异步执行(不阻塞启动)
+	Warmup bool   // 异步时: 是否为预热任务(全部成功完成后才就绪)
+}
+
 // > appInfo
 type appInfo struct {
 	Name    string
@@ -37,6 +166,13 @@ type ITimerRestorer interface {
 	Save(key string, valAt int64)
 }
 
+// 分布式锁接口(多副本下保证同一次触发只有一个副本执行)
+type ITimerLocker interface {
+
+	// 尝试加锁(锁在ttl后自动过期, 不主动释放), 失败表示其他副本已执行
+	TryLock(key string, ttl time.Duration) bool
+}
+
 // 定时器接口
 type ITimer interface {
 	// 初始化
@@ -57,8 +193,73 @@ type ITimer interface {
 	// 添加每天一次的定时器[同上](after0:每天超过零点多少时间)
 	DailyHandler(after0 time.Duration, fireFun TTimerHandFunc, opt ...*TimerOpt)
 
+	// 添加cron表达式定时器[同上](支持5/6段,范围,步长,@hourly等宏,CRON_TZ=时区前缀)
+	CronHandler(spec string, fireFun TTimerHandFunc, opt ...*TimerOpt) error
+
+	// 添加带上下文的cron定时任务[当keep为false时自动删除](ctx在超时后取消, 返回err则按TimerOpt.Retry重试)
+	JobHandler(spec string, jobFun TTimerJobFunc, opt ...*TimerOpt) error
+
 	// 移除定时器
 	DelHandler(handle TTimerHandFunc)
 	DelHandlerByName(name string)
+
+	// 最近的执行记录(按时间倒序, name为空则返回全部)
+	History(name ...string) []*TimerRecord
+
+	// 已注册的定时任务(按下次执行时间排序)
+	Jobs() []*TimerJob
 }
 type TTimerHandFunc func(now time.Time) (keep bool)
+type TTimerJobFunc func(ctx context.Context, now time.Time) (keep bool, err error)
+
+// 定时任务重叠策略
+type ETimerOverlap int //
+const (
+	ETO_Allow ETimerOverlap = iota // 允许并发执行
+	ETO_Skip                       // 上次未结束则跳过本次
+	ETO_Queue                      // 上次未结束则排队(最多一次)
+)
+
+// 定时任务执行结果
+type ETimerResult int //
+const (
+	ETR_Success ETimerResult = iota
+	ETR_Failed
+	ETR_Timeout
+	ETR_Panic
+	ETR_Skipped
+) //
+func (e ETimerResult) String() string {
+	switch e {
+	case ETR_Success:
+		return "Success"
+	case ETR_Failed:
+		return "Failed"
+	case ETR_Timeout:
+		return "Timeout"
+	case ETR_Panic:
+		return "Panic"
+	case ETR_Skipped:
+		return "Skipped"
+	}
+	return fmt.Sprintf("ETR_Unkonw(%d)", e)
+}
+
+// 定时任务信息
+type TimerJob struct {
+	Name    string    `json:"name"`
+	Spec    string    `json:"spec"` // 执行计划
+	Last    time.Time `json:"last"` // 上次触发时间
+	Next    time.Time `json:"next"` // 下次触发时间(零值:不再触发)
+	Running int       `json:"running"`
+}
+
+// 定时任务执行记录
+type TimerRecord struct {
+	Name    string        `json:"name"`
+	Start   time.Time     `json:"start"`
+	Cost    time.Duration `json:"cost"`
+	Attempt int           `json:"attempt"` // 第几次重试(0:首次)
+	Result  ETimerResult  `json:"result"`
+	Error   string        `json:"error,omitempty"` // 错误或panic信息
+}
@@ -0,0 +1,114 @@
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 获取控制器声明的依赖
+func depends(ctrl IControler) []string {
+	if d, ok := ctrl.(IDepender); ok {
+		return d.HandleDepends()
+	}
+	return nil
+}
+
+// 按依赖关系对未初始化的控制器进行拓扑排序(同层级保持安装顺序; partial:只取出依赖已满足的, 其余继续等待)
+func sortDepends(installs, starteds []IControler, partial bool) ([]IControler, error) {
+	done := map[string]bool{}
+	for _, it := range starteds {
+		done[it.HandleName()] = true
+	}
+
+	// 1. 检查缺失的依赖
+	names := map[string]IControler{}
+	for _, it := range installs {
+		names[it.HandleName()] = it
+	}
+	pending, errs := []IControler{}, []error{}
+	for _, it := range installs {
+		if done[it.HandleName()] {
+			continue
+		}
+		pending = append(pending, it)
+		for _, dep := range depends(it) {
+			if _, ok := names[dep]; !ok {
+				errs = append(errs, fmt.Errorf("control[%s] depends on [%s] which is not installed", it.HandleName(), dep))
+			}
+		}
+	}
+	if len(errs) > 0 && !partial {
+		return nil, errors.Join(errs...)
+	}
+
+	// 2. 逐层取出依赖已满足的控制器
+	orders := []IControler{}
+	for len(pending) > 0 {
+		rests := []IControler{}
+		for _, it := range pending {
+			ready := true
+			for _, dep := range depends(it) {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				rests = append(rests, it)
+				continue
+			}
+			done[it.HandleName()] = true
+			orders = append(orders, it)
+		}
+		if len(rests) == len(pending) {
+			if partial {
+				break
+			}
+			return nil, fmt.Errorf("control depends cycle: %s", findCycle(rests, names))
+		}
+		pending = rests
+	}
+	return orders, nil
+}
+
+// 在剩余控制器中找出一条循环依赖路径(a -> b -> a)
+func findCycle(rests []IControler, names map[string]IControler) string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks, path := map[string]int{}, []string{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		marks[name] = visiting
+		path = append(path, name)
+		for _, dep := range depends(names[name]) {
+			switch marks[dep] {
+			case visiting:
+				for i, it := range path {
+					if it == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case 0:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		marks[name], path = visited, path[:len(path)-1]
+		return nil
+	}
+
+	for _, it := range rests {
+		if marks[it.HandleName()] != 0 {
+			continue
+		}
+		if cycle := visit(it.HandleName()); cycle != nil {
+			return strings.Join(cycle, " -> ")
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,104 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudapex/ulib/log"
+)
+
+// 注册默认应用非控制器的健康检查项(控制器实现IHealthChecker即可)
+func RegHealth(name string, checker IHealthChecker) { std.RegHealth(name, checker) }
+
+// 默认应用是否就绪
+func Ready() bool { return std.Ready() }
+
+// 默认应用健康检查
+func Health(ctx context.Context) *HealthReport { return std.Health(ctx) }
+
+// 注册非控制器的健康检查项
+func (this *App) RegHealth(name string, checker IHealthChecker) {
+	defer this.mutex.UnLock(this.mutex.Lock())
+	this.checkers[name] = checker
+}
+
+// 是否就绪
+func (this *App) Ready() bool { return this.ready.Load() }
+
+// 健康检查(并发检查所有控制器及注册项)
+func (this *App) Health(ctx context.Context) *HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, C_HEALTH_TIME_OUT)
+	defer cancel()
+
+	names, list := []string{}, []IHealthChecker{}
+	func() {
+		defer this.mutex.RUnLock(this.mutex.RLock())
+		for name, it := range this.checkers {
+			names, list = append(names, name), append(list, it)
+		}
+	}()
+	for _, it := range this.startedList() {
+		if c, ok := it.(IHealthChecker); ok {
+			names, list = append(names, it.HandleName()), append(list, c)
+		}
+	}
+
+	report := &HealthReport{Healthy: true, Ready: this.Ready(), Items: make([]*HealthItem, len(list))}
+
+	var wg sync.WaitGroup
+	for i := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Items[i] = checkHealth(ctx, names[i], list[i])
+		}()
+	}
+	wg.Wait()
+
+	for _, it := range report.Items {
+		report.Healthy = report.Healthy && it.Healthy
+	}
+	return report
+}
+
+// 日志通道积压检查
+func logHealth(ctx context.Context) (string, error) {
+	size, capy := log.Backlog()
+	detail := fmt.Sprintf("backlog:%d/%d", size, capy)
+	if capy > 0 && size >= capy*8/10 {
+		return detail, fmt.Errorf("log channel overload")
+	}
+	return detail, nil
+}
+
+// 执行单项检查(panic与超时均视为不健康)
+func checkHealth(ctx context.Context, name string, checker IHealthChecker) *HealthItem {
+	type result struct {
+		detail string
+		err    error
+	}
+	item, begin, done := &HealthItem{Name: name}, time.Now(), make(chan result, 1)
+	go func() {
+		defer func() {
+			if x := recover(); x != nil {
+				done <- result{err: fmt.Errorf("panic: %v", x)}
+			}
+		}()
+		detail, err := checker.HandleHealth(ctx)
+		done <- result{detail, err}
+	}()
+
+	var ret result
+	select {
+	case ret = <-done:
+	case <-ctx.Done():
+		ret.err = ctx.Err()
+	}
+	item.Latency, item.Healthy, item.Detail = time.Since(begin), ret.err == nil, ret.detail
+	if ret.err != nil {
+		item.Error = ret.err.Error()
+	}
+	return item
+}
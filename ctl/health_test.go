@@ -0,0 +1,61 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type healthCtrl struct{ name string }
+
+func (c *healthCtrl) HandleName() string { return c.name }
+func (c *healthCtrl) HandleInit()        {}
+func (c *healthCtrl) HandleTerm()        {}
+func (c *healthCtrl) HandleHealth(ctx context.Context) (string, error) {
+	return "ok", nil
+}
+
+// 探针与内省在其他协程读取时, 安装与关闭可并发进行(go test -race)
+func TestHealthDuringLifecycle(t *testing.T) {
+	app := NewApp("health-race", "1.0.0")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				app.Health(context.Background())
+				app.Inspect()
+				app.RegHealth(fmt.Sprintf("probe-%d", i), THealthFunc(func(context.Context) (string, error) { return "", nil }))
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		app.Install(&healthCtrl{name: fmt.Sprintf("c%d", i)})
+	}
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	report := app.Health(context.Background())
+	if !report.Healthy || !report.Ready {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if err := app.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if app.Ready() {
+		t.Fatal("app should not be ready after stop")
+	}
+}
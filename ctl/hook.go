@@ -0,0 +1,155 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+// 默认应用: 注册启动完成后的钩子(所有控制器初始化之后执行)
+func OnStarted(fun THookFunc, opt ...*HookOpt) { std.OnStarted(fun, opt...) }
+
+// 默认应用: 注册开始关闭时的钩子(就绪置为false之后, 销毁控制器之前执行)
+func OnStopping(fun THookFunc) { std.OnStopping(fun) }
+
+// 默认应用: 注册关闭完成后的钩子(所有控制器销毁之后执行)
+func OnStopped(fun THookFunc) { std.OnStopped(fun) }
+
+// 注册启动完成后的钩子(同步钩子返回错误则启动失败; 异步钩子的ctx在关闭时取消; Warmup钩子全部完成后才就绪)
+func (this *App) OnStarted(fun THookFunc, opt ...*HookOpt) {
+	h := &hook{fun: fun}
+	util.Cast(len(opt) > 0 && opt[0] != nil, func() { h.opt = *opt[0] }, nil)
+	util.Cast(h.opt.Name == "", func() { h.opt.Name = util.FuncFullName(fun) }, nil)
+
+	started := func() bool {
+		defer this.mutex.UnLock(this.mutex.Lock())
+		this.hooksStarted = append(this.hooksStarted, h)
+		return this.started.Load()
+	}()
+	if started { // 已启动则立即执行
+		if err := this.runStarted([]*hook{h}); err != nil {
+			log.Error("Started hook[%s] err:%v", h.opt.Name, err)
+		}
+	}
+}
+
+// 注册开始关闭时的钩子
+func (this *App) OnStopping(fun THookFunc) {
+	defer this.mutex.UnLock(this.mutex.Lock())
+	this.hooksStopping = append(this.hooksStopping, &hook{fun: fun, opt: HookOpt{Name: util.FuncFullName(fun)}})
+}
+
+// 注册关闭完成后的钩子
+func (this *App) OnStopped(fun THookFunc) {
+	defer this.mutex.UnLock(this.mutex.Lock())
+	this.hooksStopped = append(this.hooksStopped, &hook{fun: fun, opt: HookOpt{Name: util.FuncFullName(fun)}})
+}
+
+// ======================================== [internal]
+
+// > 生命周期钩子
+type hook struct {
+	fun THookFunc
+	opt HookOpt
+}
+
+// 执行启动钩子(同步钩子按注册顺序执行, 异步钩子并发执行)
+func (this *App) runStarted(hooks []*hook) error {
+	ctx := func() context.Context {
+		defer this.mutex.UnLock(this.mutex.Lock())
+		if this.hookCtx == nil {
+			this.hookCtx, this.hookCancel = context.WithCancel(context.Background())
+		}
+		return this.hookCtx
+	}()
+
+	// 先计入所有预热钩子, 避免先完成的钩子在其他钩子计入前置为就绪
+	pending := int32(0)
+	for _, h := range hooks {
+		util.Cast(h.opt.Async && h.opt.Warmup, func() { pending++ }, nil)
+	}
+	this.warmups.Add(pending)
+
+	for _, h := range hooks {
+		if !h.opt.Async {
+			if err := callHook(ctx, h); err != nil {
+				this.warmups.Add(-pending) // 未启动的预热钩子不再计入
+				return fmt.Errorf("started hook[%s] err:%w", h.opt.Name, err)
+			}
+			continue
+		}
+		util.Cast(h.opt.Warmup, func() { pending-- }, nil)
+
+		util.Goroutine(fmt.Sprintf("hook[%s]", h.opt.Name), func() {
+			err := callHook(ctx, h)
+			util.Cast(err != nil, func() { log.Error("Started hook[%s] err:%v", h.opt.Name, err) }, nil)
+			if !h.opt.Warmup {
+				return
+			}
+			if err != nil {
+				err = fmt.Errorf("hook[%s] err:%w", h.opt.Name, err)
+				this.warmErr.CompareAndSwap(nil, &err)
+			}
+			if this.warmups.Add(-1) == 0 {
+				this.updateReady()
+			}
+		})
+	}
+	this.updateReady()
+	return nil
+}
+
+// 执行关闭钩子(先取消异步启动钩子; 错误只记录)
+func (this *App) runStopHooks(hooks []*hook) {
+	hookCancel := func() context.CancelFunc {
+		defer this.mutex.UnLock(this.mutex.Lock())
+		c := this.hookCancel
+		this.hookCtx, this.hookCancel = nil, nil
+		return c
+	}()
+	util.Cast(hookCancel != nil, func() { hookCancel() }, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), this.grace())
+	defer cancel()
+	for _, h := range hooks {
+		if err := callHook(ctx, h); err != nil {
+			log.Error("Stop hook[%s] err:%v", h.opt.Name, err)
+		}
+	}
+}
+
+// 钩子列表快照(钩子可能在其他协程注册)
+func (this *App) hookList(hooks *[]*hook) []*hook {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+	return append([]*hook{}, *hooks...)
+}
+
+// 就绪: 已启动, 且Warmup钩子全部成功完成
+func (this *App) updateReady() {
+	if this.started.Load() && this.warmups.Load() == 0 && this.warmErr.Load() == nil {
+		if !this.ready.Swap(true) {
+			log.InfoD(-1, "App[%s] is ready.", this.Name())
+		}
+	}
+}
+
+// 预热状态检查(预热钩子失败时不健康, 需修复后重启)
+func (this *App) warmHealth(ctx context.Context) (string, error) {
+	detail := fmt.Sprintf("pending:%d", this.warmups.Load())
+	if err := this.warmErr.Load(); err != nil {
+		return detail, *err
+	}
+	return detail, nil
+}
+
+// 调用钩子(panic转为错误)
+func callHook(ctx context.Context, h *hook) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("panic: %v", x)
+		}
+	}()
+	return h.fun(ctx)
+}
@@ -0,0 +1,98 @@
+package ctl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 先完成的预热钩子不能在其他预热钩子完成前置为就绪
+func TestWarmupReadiness(t *testing.T) {
+	app := NewApp("warmup", "")
+	release := make(chan struct{})
+	app.OnStarted(func(ctx context.Context) error { return nil }, &HookOpt{Name: "fast", Async: true, Warmup: true})
+	app.OnStarted(func(ctx context.Context) error { <-release; return nil }, &HookOpt{Name: "slow", Async: true, Warmup: true})
+
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if app.Ready() {
+		t.Fatal("ready before slow warmup done")
+	}
+	close(release)
+	waitFor(t, app.Ready)
+}
+
+// 预热失败时不就绪, 并在健康检查中报告
+func TestWarmupFailedHealth(t *testing.T) {
+	app := NewApp("warmfail", "")
+	app.OnStarted(func(ctx context.Context) error { return errors.New("cache load failed") }, &HookOpt{Name: "cache", Async: true, Warmup: true})
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	waitFor(t, func() bool { return app.warmups.Load() == 0 })
+	if app.Ready() {
+		t.Fatal("ready after warmup failed")
+	}
+	report := app.Health(context.Background())
+	if report.Healthy {
+		t.Fatal("health should report the failed warmup")
+	}
+}
+
+// 同步钩子失败时, 未启动的预热钩子不残留计数
+func TestWarmupSyncHookFailed(t *testing.T) {
+	app := NewApp("syncfail", "")
+	app.OnStarted(func(ctx context.Context) error { return errors.New("boom") })
+	app.OnStarted(func(ctx context.Context) error { return nil }, &HookOpt{Name: "later", Async: true, Warmup: true})
+	if err := app.Start(); err == nil {
+		t.Fatal("expect start err")
+	}
+	if n := app.warmups.Load(); n != 0 {
+		t.Fatalf("warmups should be 0, got %d", n)
+	}
+}
+
+// 启动期间并发注册的启动钩子恰好执行一次
+func TestHooksConcurrentRegister(t *testing.T) {
+	app := NewApp("hookrace", "")
+	var runs atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.OnStarted(func(ctx context.Context) error { runs.Add(1); return nil })
+			app.OnStopping(func(ctx context.Context) error { return nil })
+			app.OnStopped(func(ctx context.Context) error { return nil })
+		}()
+	}
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if err := app.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if n := runs.Load(); n != 20 {
+		t.Fatalf("each started hook should run once, got %d", n)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met in time")
+}
@@ -0,0 +1,50 @@
+package ctl
+
+import (
+	"sort"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+// 默认应用的运行时快照
+func Inspect() *Snapshot { return std.Inspect() }
+
+// 运行时快照(控制器, 应用信息, 运行时长, 定时任务; 控制器可实现IInspector提供详细信息)
+func (this *App) Inspect() *Snapshot {
+	snap := &Snapshot{
+		App:     this.Name(),
+		Version: this.Version(),
+		StartAt: util.TimeStart(),
+		Uptime:  util.TimeLived().String(),
+		Ready:   this.Ready(),
+	}
+
+	inits := map[string]bool{}
+	for _, it := range this.startedList() {
+		inits[it.HandleName()] = true
+	}
+	for _, it := range this.controlList() {
+		info := &ControlInfo{Name: it.HandleName(), Depends: depends(it), Started: inits[it.HandleName()]}
+		if i, ok := it.(IInspector); ok && info.Started {
+			info.Detail = i.HandleInspect()
+		}
+		snap.Controls = append(snap.Controls, info)
+	}
+
+	for _, t := range runningTimers() {
+		snap.Timers = append(snap.Timers, t.Jobs()...)
+	}
+	sort.SliceStable(snap.Timers, func(i, j int) bool { return snap.Timers[i].Name < snap.Timers[j].Name })
+	return snap
+}
+
+// 运行中的定时器
+func runningTimers() []*timer {
+	defer timersLock.UnLock(timersLock.Lock())
+
+	list := make([]*timer, 0, len(timers))
+	for t := range timers {
+		list = append(list, t)
+	}
+	return list
+}
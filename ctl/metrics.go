@@ -0,0 +1,33 @@
+package ctl
+
+import (
+	"github.com/cloudapex/ulib/met"
+	"github.com/cloudapex/ulib/util"
+)
+
+var (
+	metTimerRuns = met.NewCounter("ctl_timer_runs_total", "Timer job executions by result.", "name", "result")
+	metTimerCost = met.NewHistogram("ctl_timer_run_seconds", "Timer job execution duration.", nil, "name")
+)
+
+func init() {
+	uptime := met.NewGauge("ctl_uptime_seconds", "Seconds since process start.")
+	ready := met.NewGauge("ctl_ready", "Whether the app is ready(1) or not(0).", "app")
+	ctrls := met.NewGauge("ctl_controls", "Installed and started controllers.", "app", "state")
+	met.Collect("ctl", func() {
+		uptime.With().Set(util.TimeLived().Seconds())
+		for _, app := range appList() {
+			ready.With(app.Name()).Set(util.Tern(app.Ready(), 1.0, 0.0))
+			ctrls.With(app.Name(), "installed").Set(float64(len(app.controlList())))
+			ctrls.With(app.Name(), "started").Set(float64(len(app.startedList())))
+		}
+	})
+}
+
+// 控制器的指标命名空间(指标名以控制器名为前缀, 如 htp_requests_total)
+func Metrics(name string) met.Scope { return met.Scope(name) }
+
+// 注册应用内控制器的采集函数(以应用名区分, 多个应用安装同类控制器时互不覆盖; 指标应带app标签)
+func (this *App) Collect(scope met.Scope, name string, fun func()) {
+	scope.Collect(name+":"+this.info.Name, fun)
+}
@@ -1,8 +1,8 @@
 package ctl
 
 import (
+	"errors"
 	"flag"
-	"fmt"
 
 	"github.com/cloudapex/ulib/log"
 	"github.com/cloudapex/ulib/util"
@@ -10,34 +10,40 @@ import (
 	"github.com/spf13/pflag"
 )
 
-var (
-	app      appInfo
-	controls = []IControler{}
-)
-
-func init() {
-	util.Term(func(reason interface{}) { shut(fmt.Errorf("%v", reason)) })
-}
-
-// 初始化
+// 初始化(解析命令行, 加载配置, 初始化日志; 未指定日志配置时使用配置段"log")
 func Init(name, version string, conf ...*log.Config) interface{} {
-	app.Name, app.Version = name, version
+	std.info.Name, std.info.Version = name, version
+	confFlags()
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
-	if len(conf) > 0 && conf[0] != nil {
-		log.Init(conf[0])
-	} else {
-		log.Init(nil)
+
+	errConf := LoadConfig(pflag.Lookup("config").Value.String(), EnvPrefix())
+	logConf := util.DefaultVal(conf)
+	if logConf == nil && errConf == nil {
+		c, err := Conf[log.Config]("log")
+		switch {
+		case err == nil:
+			logConf = c
+		case !errors.Is(err, ErrSectionNotFound):
+			errConf = err
+		}
 	}
+	log.Init(logConf)
+	util.Cast(errConf != nil, func() { log.Fatal("Load config err:%v", errConf) }, nil)
 	return nil
 }
 
-// 等待结束
-func Wait(x interface{}) {
-	log.InfoD(-1, "[app_name:%q exe_name:%q app_ver:%s] Start Work...", AppName(), util.ExeName(), AppVersion())
+// 默认应用延迟初始化(Install只登记, Start时按依赖顺序统一初始化, 失败则回滚并返回错误; 需在Install之前调用)
+func DeferInit() { std.DeferInit() }
 
-	util.Wait()
-}
+// 启动默认应用(按依赖顺序初始化所有已安装的控制器, 失败则逆序销毁已初始化的控制器并返回错误)
+func Start() error { return std.Start() }
+
+// 停止默认应用(逆序销毁所有已初始化的控制器, 不退出进程)
+func Stop() error { return std.Stop() }
+
+// 等待结束(未启动则先启动)
+func Wait(x interface{}) { std.Wait() }
 
 // 终止运行
 func Shut(x interface{}) {
@@ -46,46 +52,22 @@ func Shut(x interface{}) {
 }
 
 // ======================================== [control]
-// 安装控制器
-func Install(ctrl IControler) IControler {
-	if Controler(ctrl.HandleName()) != nil {
-		log.Fatal("Control[%v] was already existed.", ctrl.HandleName())
-	}
+// 安装控制器到默认应用(默认立即初始化, 依赖尚未安装的则等待依赖安装后再初始化; DeferInit时在Start中初始化)
+func Install(ctrl IControler) IControler { return std.Install(ctrl) }
 
-	ctrl.HandleInit()
-	controls = append(controls, ctrl)
-	return ctrl
-}
-
-// 获取控制器
-func Controler(name string) IControler {
-	for _, it := range controls {
-		if it.HandleName() == name {
-			return it
-		}
-	}
-	return nil
-}
+// 获取默认应用的控制器
+func Controler(name string) IControler { return std.Controler(name) }
 
 // ======================================== [function]
 
 // AppName
-func AppName() string { return app.Name }
+func AppName() string { return std.Name() }
 
 // AppVersion
-func AppVersion() string { return app.Version }
+func AppVersion() string { return std.Version() }
 
-// ctrl field logger
-func Logger(name string) log.ILoger { return log.Field("ctrl", name) }
+// 环境变量前缀(AppName大写, 非字母数字替换为'_')
+func EnvPrefix() string { return std.EnvPrefix() }
 
-// ======================================== [internal]
-
-// 停止所有控制器(同步)
-func shut(reason error) {
-	log.InfoD(-1, "Start Shut Controls(%d)... by reason: %q", len(controls), reason)
-	defer log.InfoD(-1, "[app_name:%q exe_name:%q app_ver:%s] Shut Done.", AppName(), util.ExeName(), AppVersion())
-
-	for i := len(controls) - 1; i >= 0; i-- {
-		controls[i].HandleTerm()
-	}
-}
+// ctrl field logger
+func Logger(name string) log.ILoger { return std.Logger(name) }
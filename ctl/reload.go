@@ -0,0 +1,198 @@
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+var (
+	reloaders  = map[string]IReloader{} // 非控制器的热更处理
+	reloadLock util.RWLocker
+	watchExit  chan int
+)
+
+func init() {
+	RegReload("log", TReloadFunc(func(old, new *ConfSection) error {
+		c := &log.Config{Level: log.GetLevel()} // 未配置lv时保持当前等级(ELL_Trace为零值)
+		if err := new.Decode(c); err != nil {
+			return err
+		}
+		return log.Reload(c)
+	}))
+}
+
+// 注册非控制器的配置段热更处理(控制器实现IReloader即可)
+func RegReload(name string, reloader IReloader) {
+	defer reloadLock.UnLock(reloadLock.Lock())
+	reloaders[strings.ToLower(name)] = reloader
+}
+func reloaderOf(name string) IReloader {
+	defer reloadLock.RUnLock(reloadLock.RLock())
+	return reloaders[name]
+}
+
+// 开始监视配置文件(修改时间轮询; SIGHUP默认也会触发重新加载)
+func WatchConfig(interval ...time.Duration) {
+	if watchExit != nil {
+		return
+	}
+	d := util.DefaultVal(interval)
+	util.Cast(d <= 0, func() { d = C_CONF_WATCH_INTERVAL }, nil)
+
+	watchExit = make(chan int)
+	go watch(watchExit, current().file, d)
+}
+
+// 重新加载配置, 并通知默认应用(及ShareConf的应用)中配置段有变更的控制器
+// 逐段提交: 热更成功(或仅有需重启生效的项, 作为警告报告)的配置段提交新值, 失败的配置段保留旧值以便下次重试
+func Reload() error {
+	old := current()
+	c, err := loadConfig(old.file, old.envPrefix, confSets)
+	if err != nil {
+		return err
+	}
+
+	errs, keeps := []error{}, []string{}
+	for _, name := range changedSections(old, c) {
+		oldSec, newSec := section(old, name), section(c, name)
+
+		failed, apps, targets := false, []string{}, []IReloader{}
+		for _, app := range appList() {
+			if app != std && !app.sharConf { // 非默认应用的控制器未由全局配置段构建
+				continue
+			}
+			ctrl := app.startedControl(name)
+			if ctrl == nil {
+				continue
+			}
+			r, ok := ctrl.(IReloader)
+			if !ok {
+				errs, failed = append(errs, fmt.Errorf("config[%s] changed but control of app[%s] not support reload", name, app.Name())), true
+				continue
+			}
+			apps, targets = append(apps, app.Name()), append(targets, r)
+		}
+		if r := reloaderOf(name); len(targets) == 0 && r != nil {
+			apps, targets = append(apps, ""), append(targets, r)
+		}
+
+		for i, reloader := range targets {
+			err := reloadSection(reloader, oldSec, newSec)
+			switch {
+			case err == nil:
+			case errors.Is(err, ErrRestartOnly):
+				log.Warn("Reload config[%s](app:%q) %v", name, apps[i], err)
+			default:
+				errs, failed = append(errs, fmt.Errorf("config[%s] reload(app:%q): %w", name, apps[i], err)), true
+			}
+		}
+		if failed {
+			keeps = append(keeps, name)
+			continue
+		}
+		util.Cast(len(targets) > 0, func() { log.InfoD(-1, "Reload config[%s] done.", name) }, nil)
+	}
+	setCurrent(c.keep(old, keeps))
+	return errors.Join(errs...)
+}
+
+// ======================================== [internal]
+
+func watch(exit chan int, file string, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	modAt := modTime(file)
+	for {
+		select {
+		case <-exit:
+			return
+		case <-t.C:
+			if at := modTime(file); at.Equal(modAt) {
+				continue
+			} else {
+				modAt = at
+			}
+			log.Info("Reload config by file %q modified...", file)
+		}
+		if err := Reload(); err != nil {
+			log.Warn("Reload config err:%v", err)
+		}
+	}
+}
+
+// 停止监视配置
+func unwatch() {
+	if watchExit != nil {
+		close(watchExit)
+		watchExit = nil
+	}
+}
+
+func modTime(file string) time.Time {
+	if file == "" {
+		return time.Time{}
+	}
+	if info, err := os.Stat(file); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// 对比得出有变更的顶层配置段
+func changedSections(old, new *config) (names []string) {
+	keys := map[string]bool{}
+	for k := range old.tree {
+		keys[strings.ToLower(k)] = true
+	}
+	for k := range new.tree {
+		keys[strings.ToLower(k)] = true
+	}
+	for k := range keys {
+		a, _ := old.node(k)
+		b, _ := new.node(k)
+		da, _ := json.Marshal(a)
+		db, _ := json.Marshal(b)
+		if string(da) != string(db) {
+			names = append(names, k)
+		}
+	}
+	return
+}
+
+// 热更失败的配置段保留old中的旧值(不存在则移除)
+func (c *config) keep(old *config, names []string) *config {
+	if len(names) == 0 {
+		return c
+	}
+	tree := maps.Clone(c.tree)
+	for _, name := range names {
+		maps.DeleteFunc(tree, func(k string, _ interface{}) bool { return strings.EqualFold(k, name) })
+		for k, v := range old.tree {
+			util.Cast(strings.EqualFold(k, name), func() { tree[k] = v }, nil)
+		}
+	}
+	return &config{file: c.file, envPrefix: c.envPrefix, tree: tree}
+}
+
+func section(c *config, name string) *ConfSection {
+	node, ok := c.node(name)
+	return &ConfSection{Name: name, node: node, exist: ok}
+}
+
+func reloadSection(reloader IReloader, old, new *ConfSection) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("panic: %v", x)
+		}
+	}()
+	return reloader.HandleReload(old, new)
+}
@@ -0,0 +1,64 @@
+package ctl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+// 文件存储的定时器状态(单机工具使用, 文件内以AppName区分服务)
+func FileTimerRestorer(file string) ITimerRestorer { return &fileRestorer{file: file} }
+
+type fileRestorer struct {
+	mutex util.Locker
+	file  string
+}
+
+func (r *fileRestorer) Load() map[string]int64 {
+	defer r.mutex.UnLock(r.mutex.Lock())
+	return r.read()[AppName()]
+}
+
+// 读改写整个文件, 并以临时文件+rename保证写入原子性
+func (r *fileRestorer) Save(key string, valAt int64) {
+	defer r.mutex.UnLock(r.mutex.Lock())
+
+	all := r.read()
+	if all[AppName()] == nil {
+		all[AppName()] = map[string]int64{}
+	}
+	all[AppName()][key] = valAt
+
+	data, _ := json.MarshalIndent(all, "", "  ")
+	tmp := r.file + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(r.file), os.ModePerm); err != nil {
+		log.Error("ctl.FileTimerRestorer mkdir %q err:%v", r.file, err)
+		return
+	}
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Error("ctl.FileTimerRestorer write %q err:%v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, r.file); err != nil {
+		log.Error("ctl.FileTimerRestorer rename %q err:%v", r.file, err)
+	}
+}
+
+// 读取文件(app => name => lastAt)
+func (r *fileRestorer) read() map[string]map[string]int64 {
+	all := map[string]map[string]int64{}
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("ctl.FileTimerRestorer read %q err:%v", r.file, err)
+		}
+		return all
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		log.Error("ctl.FileTimerRestorer parse %q err:%v", r.file, err)
+	}
+	return all
+}
@@ -0,0 +1,157 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+// 设置默认应用优雅关闭的总宽限时间(所有控制器共享)
+func SetShutGrace(grace time.Duration) { std.SetShutGrace(grace) }
+
+// 设置默认应用某控制器的关闭预算(默认为剩余的总宽限时间)
+func SetShutBudget(name string, budget time.Duration) { std.SetShutBudget(name, budget) }
+
+// 设置优雅关闭的总宽限时间(所有控制器共享)
+func (this *App) SetShutGrace(grace time.Duration) {
+	defer this.mutex.UnLock(this.mutex.Lock())
+	util.Cast(grace > 0, func() { this.shutGrace = grace }, nil)
+}
+
+// 设置某控制器的关闭预算(默认为剩余的总宽限时间)
+func (this *App) SetShutBudget(name string, budget time.Duration) {
+	defer this.mutex.UnLock(this.mutex.Lock())
+	this.shutBudgets[name] = budget
+}
+
+// 销毁所有已初始化的控制器(同步, 逆拓扑序, 各控制器的预算不超过剩余的总宽限时间)
+//
+//	超出预算的控制器不再等待, 但它依赖的控制器会等它销毁完成(受自身预算约束), 否则推迟到最后再销毁(仍不保证逆拓扑序, 但不遗漏)
+func (this *App) terminate() (errs []error) {
+	deadline, starteds := time.Now().Add(this.grace()), this.startedList()
+
+	running := map[string]<-chan struct{}{} // 超出预算仍在销毁的
+	skipped := map[string]bool{}            // 因依赖者未销毁完成而推迟的
+	defers, exceeds := []IControler{}, []string{}
+	term := func(ctrl IControler, budget time.Duration, begin time.Time) {
+		name := ctrl.HandleName()
+		done, err := termControl(ctrl, budget-time.Since(begin))
+		cost := time.Since(begin)
+
+		if done != nil || cost > budget {
+			util.Cast(done != nil, func() { running[name] = done }, nil)
+			exceeds = append(exceeds, name)
+			log.WarnD(-1, "Shut control[%s] exceeded budget(%v) cost:%v", name, budget, cost)
+		} else {
+			log.InfoD(-1, "Shut control[%s] done cost:%v", name, cost)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("control[%s] term err:%w", name, err))
+		}
+	}
+	for i := len(starteds) - 1; i >= 0; i-- {
+		ctrl := starteds[i]
+		name, budget, begin := ctrl.HandleName(), this.termBudget(ctrl.HandleName(), deadline), time.Now()
+		if dep := waitDependants(name, starteds[i+1:], running, skipped, begin.Add(budget)); dep != "" {
+			skipped[name], defers = true, append(defers, ctrl)
+			log.WarnD(-1, "Shut control[%s] deferred, dependant[%s] is still terminating", name, dep)
+			continue
+		}
+		term(ctrl, budget, begin)
+	}
+
+	// 推迟的控制器最后销毁(按推迟顺序, 即依赖者在前): 在剩余的总宽限时间内再等待依赖者, 之后不再等待
+	for _, ctrl := range defers {
+		name := ctrl.HandleName()
+		if dep := waitDependants(name, starteds, running, nil, deadline); dep != "" {
+			errs = append(errs, fmt.Errorf("control[%s] terminated while dependant[%s] is still terminating", name, dep))
+		}
+		term(ctrl, this.termBudget(name, deadline), time.Now())
+	}
+	if len(exceeds) > 0 {
+		errs = append(errs, fmt.Errorf("controls%v exceeded shut budget", exceeds))
+	}
+	func() { defer this.mutex.UnLock(this.mutex.Lock()); this.starteds = []IControler{} }()
+	return
+}
+
+// 控制器的关闭预算(不超过剩余的总宽限时间, 且不少于C_SHUT_MIN_BUDGET)
+func (this *App) termBudget(name string, deadline time.Time) time.Duration {
+	budget := max(time.Until(deadline), C_SHUT_MIN_BUDGET)
+	if d := this.shutBudget(name); d > 0 {
+		budget = min(d, budget)
+	}
+	return budget
+}
+
+func (this *App) grace() time.Duration {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+	return this.shutGrace
+}
+func (this *App) shutBudget(name string) time.Duration {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+	return this.shutBudgets[name]
+}
+
+// 等待依赖name且超出预算仍在销毁的控制器(返回到期仍未完成或已被跳过的依赖者)
+func waitDependants(name string, laters []IControler, running map[string]<-chan struct{}, skipped map[string]bool, until time.Time) string {
+	for _, it := range laters {
+		if !slices.Contains(depends(it), name) {
+			continue
+		}
+		if skipped[it.HandleName()] {
+			return it.HandleName()
+		}
+		done, ok := running[it.HandleName()]
+		if !ok {
+			continue
+		}
+		timer := time.NewTimer(time.Until(until))
+		select {
+		case <-done:
+			timer.Stop()
+			delete(running, it.HandleName())
+		case <-timer.C:
+			return it.HandleName()
+		}
+	}
+	return ""
+}
+
+// 销毁单个控制器(panic转为错误; 超出预算则放弃等待, 返回其销毁完成时关闭的通道)
+func termControl(ctrl IControler, budget time.Duration) (<-chan struct{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+
+	done, finish := make(chan error, 1), make(chan struct{})
+	go func() {
+		defer close(finish)
+		defer cancel()
+		defer func() {
+			if x := recover(); x != nil {
+				done <- fmt.Errorf("panic: %v", x)
+			}
+		}()
+		if c, ok := ctrl.(IControlerC); ok {
+			done <- c.HandleTermC(ctx)
+			return
+		}
+		ctrl.HandleTerm()
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return nil, err
+	case <-ctx.Done():
+		select {
+		case err := <-done: // 恰好完成
+			return nil, err
+		default:
+			return finish, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package ctl
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type slowCtrl struct {
+	name  string
+	deps  []string
+	sleep time.Duration
+
+	mu     *sync.Mutex
+	events *[]string
+}
+
+func (c *slowCtrl) HandleName() string      { return c.name }
+func (c *slowCtrl) HandleDepends() []string { return c.deps }
+func (c *slowCtrl) HandleInit()             {}
+func (c *slowCtrl) HandleTerm() {
+	time.Sleep(c.sleep)
+	c.mu.Lock()
+	*c.events = append(*c.events, "term:"+c.name)
+	c.mu.Unlock()
+}
+
+func TestTerminateWaitsAbandonedDependant(t *testing.T) {
+	mu, events := &sync.Mutex{}, []string{}
+	app := NewApp("shut-order", "1.0.0")
+	app.SetShutGrace(2 * time.Second)
+	app.SetShutBudget("b", 50*time.Millisecond)
+	app.Install(&slowCtrl{name: "a", mu: mu, events: &events})
+	app.Install(&slowCtrl{name: "b", deps: []string{"a"}, sleep: 200 * time.Millisecond, mu: mu, events: &events})
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := app.Stop()
+	if err == nil || !strings.Contains(err.Error(), "exceeded shut budget") {
+		t.Fatalf("expect exceeded err, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(events, ","); got != "term:b,term:a" {
+		t.Fatalf("dependency terminated before its dependant: %q", got)
+	}
+}
+
+// 依赖者挂起时推迟销毁被依赖者, 但最后仍会销毁
+func TestTerminateDefersWhenDependantHangs(t *testing.T) {
+	mu, events := &sync.Mutex{}, []string{}
+	app := NewApp("shut-skip", "1.0.0")
+	app.SetShutGrace(100 * time.Millisecond)
+	app.Install(&slowCtrl{name: "a", mu: mu, events: &events})
+	app.Install(&slowCtrl{name: "b", deps: []string{"a"}, sleep: 5 * time.Second, mu: mu, events: &events})
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	err := app.Stop()
+	if err == nil || !strings.Contains(err.Error(), "control[a] terminated while dependant[b] is still terminating") {
+		t.Fatalf("expect deferred err, got %v", err)
+	}
+	if cost := time.Since(begin); cost > 3*C_SHUT_MIN_BUDGET {
+		t.Fatalf("terminate should not wait for hanging control, cost:%v", cost)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(events, ","); got != "term:a" {
+		t.Fatalf("deferred control should be terminated at last, got %q", got)
+	}
+}
+
+func TestTerminateRemainingGrace(t *testing.T) {
+	mu, events := &sync.Mutex{}, []string{}
+	app := NewApp("shut-grace", "1.0.0")
+	app.SetShutGrace(time.Second)
+	app.Install(&slowCtrl{name: "a", sleep: 100 * time.Millisecond, mu: mu, events: &events})
+	app.Install(&slowCtrl{name: "b", sleep: 5 * time.Second, mu: mu, events: &events})
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// b耗尽总宽限时间后, a仍获得C_SHUT_MIN_BUDGET
+	begin := time.Now()
+	err := app.Stop()
+	if err == nil || !strings.Contains(err.Error(), "[b]") || strings.Contains(err.Error(), "[b a]") {
+		t.Fatalf("only b should exceed, got %v", err)
+	}
+	if cost := time.Since(begin); cost > time.Second+C_SHUT_MIN_BUDGET {
+		t.Fatalf("terminate exceeded grace, cost:%v", cost)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(events, ","); got != "term:a" {
+		t.Fatalf("unexpected terms %q", got)
+	}
+}
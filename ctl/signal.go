@@ -0,0 +1,37 @@
+package ctl
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+func init() {
+	OnSignal(syscall.SIGHUP, func(os.Signal) {
+		log.Info("Reload config by signal SIGHUP...")
+		if err := Reload(); err != nil {
+			log.Warn("Reload config err:%v", err)
+		}
+	})
+}
+
+// 设置触发优雅关闭的信号(默认SIGINT SIGTERM SIGQUIT)
+func ShutSignals(sigs ...os.Signal) { util.TermSignals(sigs...) }
+
+// 注册信号钩子(不触发关闭, 如SIGUSR1 SIGUSR2; 默认SIGHUP为重新加载配置; fun为nil则移除)
+func OnSignal(sig os.Signal, fun func(os.Signal)) { util.OnSignal(sig, fun) }
+
+// 因致命错误优雅关闭所有应用, 并以非零退出码(C_EXIT_CODE_FATAL)结束进程
+func Fail(err error) {
+	log.ErrorD(1, "Fatal err:%v, shut with exit code %d", err, C_EXIT_CODE_FATAL)
+	util.QuitCode(C_EXIT_CODE_FATAL, err)
+}
+
+// 信号钩子: 输出所有goroutine堆栈到日志
+func SigDumpStacks(sig os.Signal) {
+	buf := make([]byte, 1<<20)
+	log.Info("Dump goroutines by signal %v:\n%s", sig, buf[:runtime.Stack(buf, true)])
+}
@@ -1,30 +1,48 @@
 package ctl
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
-	"reflect"
+	"runtime"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/cloudapex/ulib/log"
 	"github.com/cloudapex/ulib/util"
 )
 
-func Timer() ITimer { return &timer{} }
+func Timer() ITimer { return std.Timer() }
+
+var (
+	timers     = map[*timer]bool{} // 运行中的定时器(供Inspect)
+	timersLock util.Locker
+)
 
 // timer
 type timer struct {
+	app      *App // 所属应用(分布式锁以应用名区分服务)
 	mutex    util.RWLocker
 	cronjobs map[string]*cronjob
+	queue    cronQueue // 按下次执行时间排序的小顶堆
 
-	interval time.Duration // 定时器tick时间间隔
+	interval time.Duration // 定时器最长休眠时间(兜底检测间隔)
 
+	sgWake   chan int
 	sgExit   chan int
+	sgDone   chan int // Close时关闭(中断重试等待)
 	wgExit   sync.WaitGroup
+	onceExit sync.Once
 	restorer ITimerRestorer // 外部状态存储器
+
+	records timerRecords // 最近的执行记录
 }
 
 func (this *timer) Init(tickerInterval ...time.Duration) *timer {
 	this.cronjobs = make(map[string]*cronjob)
+	this.sgWake, this.sgDone = make(chan int, 1), make(chan int)
+	this.records.init(C_TIMER_RECORD_SIZE)
 
 	this.interval = util.DefaultVal(tickerInterval)
 	util.Cast(this.interval == 0, func() { this.interval = C_TIMER_TICK_INTERVAL }, nil)
@@ -33,85 +51,233 @@ func (this *timer) Init(tickerInterval ...time.Duration) *timer {
 }
 func (this *timer) Start(restorer ...ITimerRestorer) *timer {
 	this.sgExit = make(chan int)
+	func() { defer timersLock.UnLock(timersLock.Lock()); timers[this] = true }()
 
 	util.Cast(len(restorer) > 0 && restorer[0] != nil, func() { this.Restore(restorer[0]) }, nil)
 
 	return func() *timer { go this.loop(); return this }()
 }
 func (this *timer) Close() {
-	util.Cast(this.sgExit != nil, func() { this.sgExit <- 0 }, nil)
+	this.onceExit.Do(func() {
+		util.Cast(this.sgExit != nil, func() { this.sgExit <- 0 }, nil)
+		util.Cast(this.sgDone != nil, func() { close(this.sgDone) }, nil)
+		func() { defer timersLock.UnLock(timersLock.Lock()); delete(timers, this) }()
+	})
 
-	this.wgExit.Wait()
+	done := make(chan int)
+	go func() { this.wgExit.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(C_TIMER_CLOSE_TIME_OUT): // 不响应ctx的任务无法中断, 不再等待
+		log.Warn("Timer close wait running cronjobs timeout(%v)", C_TIMER_CLOSE_TIME_OUT)
+	}
 }
 
 // 设置并恢复状态(需要在Handler添加之后调用)
 func (this *timer) Restore(restorer ITimerRestorer) {
+	defer this.wake()
+	defer this.mutex.UnLock(this.mutex.Lock())
+
 	this.restorer = restorer
 
+	now := time.Now()
 	for name, last := range restorer.Load() {
-		for name_, it := range this.cronjobs {
-			if name_ == name {
-				it.last = time.Unix(last, 0)
-				break
-			}
+		if it, ok := this.cronjobs[name]; ok {
+			it.last = time.Unix(last, 0)
+			it.next = it.sched.next(it.last, now)
 		}
 	}
+	heap.Init(&this.queue)
 }
 func (this *timer) TimerHandler(interval time.Duration, handle TTimerHandFunc, opt ...*TimerOpt) {
-	this.addHandler(interval, handle, false, opt...)
+	this.addHandler(&everySchedule{interval: interval}, wrapHandFunc(handle), util.FuncFullName(handle), false, opt...)
 }
 func (this *timer) DailyHandler(absolute time.Duration, handle TTimerHandFunc, opt ...*TimerOpt) {
-	this.addHandler(absolute, handle, true, opt...)
+	loc := time.Local
+	if len(opt) > 0 && opt[0] != nil && opt[0].Location != nil {
+		loc = opt[0].Location
+	}
+	this.addHandler(&dailySchedule{absolute, loc}, wrapHandFunc(handle), util.FuncFullName(handle), true, opt...)
+}
+func (this *timer) CronHandler(spec string, handle TTimerHandFunc, opt ...*TimerOpt) error {
+	var loc *time.Location
+	if len(opt) > 0 && opt[0] != nil {
+		loc = opt[0].Location
+	}
+	sched, err := parseCron(spec, loc)
+	if err != nil {
+		return err
+	}
+	this.addHandler(sched, wrapHandFunc(handle), util.FuncFullName(handle), false, opt...)
+	return nil
+}
+func (this *timer) JobHandler(spec string, job TTimerJobFunc, opt ...*TimerOpt) error {
+	var loc *time.Location
+	if len(opt) > 0 && opt[0] != nil {
+		loc = opt[0].Location
+	}
+	sched, err := parseCron(spec, loc)
+	if err != nil {
+		return err
+	}
+	this.addHandler(sched, job, util.FuncFullName(job), false, opt...)
+	return nil
+}
+func (this *timer) History(name ...string) []*TimerRecord {
+	return this.records.list(util.DefaultVal(name))
+}
+func (this *timer) Jobs() []*TimerJob {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+
+	jobs := make([]*TimerJob, 0, len(this.cronjobs))
+	for _, it := range this.cronjobs {
+		jobs = append(jobs, &TimerJob{Name: it.name, Spec: it.sched.String(), Last: it.last, Next: it.next, Running: it.running})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Next.Before(jobs[j].Next) })
+	return jobs
 }
 func (this *timer) DelHandler(handle TTimerHandFunc) {
-	defer this.mutex.UnLock(this.mutex.Lock())
-	delete(this.cronjobs, util.FuncFullNameRef(reflect.ValueOf(handle)))
+	this.DelHandlerByName(util.FuncFullName(handle))
 }
 func (this *timer) DelHandlerByName(name string) {
 	defer this.mutex.UnLock(this.mutex.Lock())
-	delete(this.cronjobs, name)
+	if it, ok := this.cronjobs[name]; ok {
+		delete(this.cronjobs, name)
+		util.Cast(it.index >= 0, func() { heap.Remove(&this.queue, it.index) }, nil)
+	}
 }
 
 // --------------------
 
 func (this *timer) tick() {
-	defer this.mutex.RUnLock(this.mutex.RLock())
-	if len(this.cronjobs) == 0 {
-		return
+	saves := map[string]int64{}
+	restorer := func() ITimerRestorer {
+		defer this.mutex.UnLock(this.mutex.Lock())
+		this.fire(time.Now(), saves)
+		return this.restorer
+	}()
+	for name, at := range saves { // 外部存储可能较慢, 不持锁保存
+		restorer.Save(name, at)
 	}
+}
 
-	curTime := time.Now()
-	for name, t := range this.cronjobs {
-		lstTime := t.last
+// 执行到期的任务(需持有写锁; 需保存的状态记入saves)
+func (this *timer) fire(curTime time.Time, saves map[string]int64) {
+	for len(this.queue) > 0 && !this.queue[0].next.After(curTime) {
+		t := this.queue[0]
 
-		if t.daily {
-			if curTime.YearDay() == t.last.YearDay() {
+		// 计划触发时间(各副本一致, 用作分布式锁key); 互斥任务的last为最近一次成功执行
+		fire := t.next
+		util.Cast(t.locker == nil, func() { t.last = curTime }, nil)
+		t.next = t.sched.next(curTime, curTime)
+		if t.next.IsZero() { // 不会再触发
+			heap.Pop(&this.queue)
+		} else {
+			heap.Fix(&this.queue, 0)
+		}
+		util.Cast(t.store && t.locker == nil && this.restorer != nil, func() { saves[t.name] = t.last.Unix() }, nil)
+
+		// 重叠策略
+		if t.running > 0 {
+			switch t.opt.Overlap {
+			case ETO_Skip:
+				this.records.add(&TimerRecord{Name: t.name, Start: curTime, Result: ETR_Skipped})
+				metTimerRuns.With(t.name, ETR_Skipped.String()).Inc()
+				continue
+			case ETO_Queue:
+				t.pending, t.pendingAt, t.pendingFire = true, curTime, fire
 				continue
 			}
-			lstTime = time.Date(curTime.Year(), curTime.Month(), curTime.Day(), 0, 0, 0, 0, curTime.Location())
 		}
+		this.launch(t, curTime, fire)
+	}
+}
 
-		if curTime.Sub(lstTime) <= t.interval {
-			continue
-		}
+// 启动一次执行(需持有写锁; 任务已被移除或替换则不再执行)
+func (this *timer) launch(t *cronjob, at, fire time.Time) {
+	if this.cronjobs[t.name] != t {
+		return
+	}
+	t.running++
+	ttl := lockTTL(at, t.next)
+	util.Goroutine(fmt.Sprintf("cronjob[%q]", t.name), func() {
+		keep := this.run(t, at, fire, ttl)
 
-		t.last = curTime
-		if t.store && this.restorer != nil {
-			this.restorer.Save(t.name, t.last.Unix())
+		defer this.mutex.UnLock(this.mutex.Lock())
+		t.running--
+		if !keep {
+			if this.cronjobs[t.name] == t {
+				delete(this.cronjobs, t.name)
+				util.Cast(t.index >= 0, func() { heap.Remove(&this.queue, t.index) }, nil)
+			}
+			return
+		}
+		if t.pending { // 排队的一次
+			t.pending = false
+			this.launch(t, t.pendingAt, t.pendingFire)
 		}
+	}, &this.wgExit)
+}
+
+// 执行任务(分布式锁, 超时, 失败重试, 记录)
+func (this *timer) run(t *cronjob, at, fire time.Time, ttl time.Duration) (keep bool) {
+	// 多副本互斥: 抢锁失败说明其他副本已执行本次触发
+	if t.locker != nil && !t.locker.TryLock(lockKey(this.owner(), t.name, fire), ttl) {
+		return true
+	}
 
-		_name, _fun := name, t.fun
-		util.Goroutine(fmt.Sprintf("cronjob[%q]", _name), func() {
-			if ret := _fun.Call([]reflect.Value{reflect.ValueOf(curTime)}); !ret[0].Bool() {
-				this.DelHandlerByName(_name)
+	for attempt := 0; ; attempt++ {
+		rec := &TimerRecord{Name: t.name, Start: time.Now(), Attempt: attempt}
+		keep, rec.Result, rec.Error = callJob(t.fun, at, t.opt.Timeout)
+		rec.Cost = time.Since(rec.Start)
+		this.records.add(rec)
+		metTimerRuns.With(t.name, rec.Result.String()).Inc()
+		metTimerCost.With(t.name).Observe(rec.Cost.Seconds())
+
+		if rec.Result == ETR_Success {
+			if t.locker != nil { // 记录最近一次成功执行(计划触发时间), 供重启或替换后的副本Restore时恢复
+				restorer := func() ITimerRestorer { defer this.mutex.UnLock(this.mutex.Lock()); t.last = fire; return this.restorer }()
+				util.Cast(restorer != nil, func() { restorer.Save(t.name, fire.Unix()) }, nil)
 			}
-		}, &this.wgExit)
+			return keep
+		}
+		log.WarnD(-1, "cronjob[%q] run %v(attempt:%d) err:%s", t.name, rec.Result, attempt, rec.Error)
+		if attempt >= t.opt.Retry {
+			return keep
+		}
+
+		// 退避等待
+		select {
+		case <-time.After(util.Backoff(t.opt.RetryDelay, attempt, C_TIMER_RETRY_MAX)):
+		case <-this.sgDone:
+			return keep
+		}
+	}
+}
+
+// 距离最近一次执行的等待时间(不超过interval)
+func (this *timer) wait() time.Duration {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+
+	d := this.interval
+	if len(this.queue) > 0 {
+		d = min(d, time.Until(this.queue[0].next))
+	}
+	return max(d, 0)
+}
+
+// 唤醒loop重新计算等待时间
+func (this *timer) wake() {
+	select {
+	case this.sgWake <- 0:
+	default:
 	}
 }
 func (this *timer) loop() {
-	t := time.NewTicker(this.interval)
+	t := time.NewTimer(this.wait())
 
 	defer func() {
+		t.Stop()
 		if util.Catch("Timer.loop() panic and it will resume", recover()) {
 			go this.loop()
 		}
@@ -121,47 +287,220 @@ func (this *timer) loop() {
 		select {
 		case <-t.C:
 			this.tick()
+		case <-this.sgWake:
+			if !t.Stop() {
+				select {
+				case <-t.C:
+				default:
+				}
+			}
 		case <-this.sgExit:
 			return
 		}
+		t.Reset(this.wait())
 	}
 }
-func (this *timer) addHandler(interval time.Duration, handle TTimerHandFunc, daily bool, opt ...*TimerOpt) {
+func (this *timer) addHandler(sched schedule, job TTimerJobFunc, name string, daily bool, opt ...*TimerOpt) {
 	var _opt TimerOpt
 	if len(opt) > 0 && opt[0] != nil {
 		_opt = *opt[0]
 	}
+	util.Cast(_opt.Name == "", func() { _opt.Name = name }, nil)
+	util.Cast(_opt.RetryDelay <= 0, func() { _opt.RetryDelay = C_TIMER_RETRY_DELAY }, nil)
+
+	if es, ok := sched.(*everySchedule); ok && _opt.Locker != nil { // 对齐间隔边界, 各副本的计划触发时间一致
+		sched = &everySchedule{interval: es.interval, align: true}
+	}
 
-	last := time.Now()
+	now := time.Now()
+	last := now
 	if _opt.Right {
 		if daily { // 当天时间只要满足则执行,否则次日才会开始执行
 			last = time.Time{}
-		} else if !handle(time.Now()) { // 立即执行
-			return
+		} else if _opt.Locker == nil || this.rightLock(_opt.Name, _opt.Locker, sched, now) {
+			if keep, _, _ := callJob(job, now, _opt.Timeout); !keep { // 立即执行
+				return
+			}
 		}
 	}
 
-	t := &cronjob{_opt.Name, last, daily, _opt.Store, interval, reflect.ValueOf(handle)}
-	if t.name == "" {
-		t.name = util.FuncFullNameRef(t.fun)
-	}
+	t := &cronjob{name: _opt.Name, last: last, store: _opt.Store, sched: sched, fun: job, locker: _opt.Locker, opt: _opt, index: -1}
+	t.next = sched.next(last, now)
 
+	defer this.wake()
 	defer this.mutex.UnLock(this.mutex.Lock())
+	if old, ok := this.cronjobs[t.name]; ok && old.index >= 0 {
+		heap.Remove(&this.queue, old.index)
+	}
 	this.cronjobs[t.name] = t
+	util.Cast(!t.next.IsZero(), func() { heap.Push(&this.queue, t) }, nil)
+}
+
+// 启动时立即执行的分布式锁(以下次计划触发时间为启动窗口, 同一窗口内启动的副本仅一个执行; 有效期至少一个执行间隔)
+func (this *timer) rightLock(name string, locker ITimerLocker, sched schedule, now time.Time) bool {
+	next := sched.next(now, now)
+	if next.IsZero() {
+		return locker.TryLock(lockKey(this.owner(), name+":right", next), C_TIMER_LOCK_TTL_MAX)
+	}
+	ttl := next.Sub(now)
+	util.Cast(!sched.next(next, next).IsZero(), func() { ttl = max(ttl, sched.next(next, next).Sub(next)) }, nil)
+	return locker.TryLock(lockKey(this.owner(), name+":right", next), min(max(ttl, C_TIMER_LOCK_TTL_MIN), C_TIMER_LOCK_TTL_MAX))
 }
 
 // ==================== cronjob
 type cronjob struct {
-	name         string        // 定时任务的名称
-	last         time.Time     // 上次执行的时间
-	daily, store bool          // 是否是日常类型,是否需要保存状态
-	interval     time.Duration // 调用间隔时间
-	fun          reflect.Value // 调用函数
+	name  string        // 定时任务的名称
+	last  time.Time     // 上次执行的时间
+	next  time.Time     // 下次执行的时间
+	store bool          // 是否需要保存状态
+	sched schedule      // 执行时间计划
+	fun   TTimerJobFunc // 调用函数
+	index int           // 在堆中的位置(-1:不在堆中)
+
+	locker ITimerLocker // 分布式锁(nil:不互斥)
+	opt    TimerOpt     // 可选参数
+
+	running     int       // 正在执行的数量
+	pending     bool      // 是否有排队等待的一次执行(ETO_Queue)
+	pendingAt   time.Time // 排队的触发时间
+	pendingFire time.Time // 排队的计划触发时间
+}
+
+// 包装普通定时器函数
+func wrapHandFunc(handle TTimerHandFunc) TTimerJobFunc {
+	return func(ctx context.Context, now time.Time) (bool, error) { return handle(now), nil }
+}
+
+// 调用任务函数(超时取消, panic转为错误)
+// 在当前goroutine中同步执行: 超时仅取消ctx, 任务需响应ctx.Done()才能及时返回(否则返回后才记为超时)
+func callJob(job TTimerJobFunc, at time.Time, timeout time.Duration) (keep bool, result ETimerResult, errStr string) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	defer func() {
+		if x := recover(); x != nil {
+			buf := make([]byte, 2048)
+			keep, result, errStr = true, ETR_Panic, fmt.Sprintf("%v\n%s", x, buf[:runtime.Stack(buf, false)])
+		}
+	}()
+
+	keep, err := job(ctx, at)
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return keep, ETR_Timeout, fmt.Sprintf("timeout(%v)", timeout)
+	case err != nil:
+		return keep, ETR_Failed, err.Error()
+	}
+	return keep, ETR_Success, ""
+}
+
+// 所属应用(未绑定则为默认应用)
+func (this *timer) owner() *App { return util.Tern(this.app != nil, this.app, std) }
+
+// 分布式锁的key(以所属应用名区分服务, 含计划触发时间以区分每次触发或启动窗口)
+func lockKey(app *App, name string, fire time.Time) string {
+	if fire.IsZero() {
+		return fmt.Sprintf("ulib:timer:%s:%s", app.Name(), name)
+	}
+	return fmt.Sprintf("ulib:timer:%s:%s:%d", app.Name(), name, fire.UnixMilli())
+}
+
+// 分布式锁的有效期(覆盖到下次触发之前, 以吸收副本间的时钟偏差)
+func lockTTL(now, next time.Time) time.Duration {
+	if next.IsZero() {
+		return C_TIMER_LOCK_TTL_MAX
+	}
+	return min(max(next.Sub(now)*9/10, C_TIMER_LOCK_TTL_MIN), C_TIMER_LOCK_TTL_MAX)
+}
+
+// 小顶堆(container/heap)
+type cronQueue []*cronjob
+
+func (q cronQueue) Len() int           { return len(q) }
+func (q cronQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q cronQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+func (q *cronQueue) Push(x any) {
+	t := x.(*cronjob)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+func (q *cronQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1], t.index = nil, -1
+	*q = old[:len(old)-1]
+	return t
 }
 
 // ==================== TimerOpt(可选参数)
 type TimerOpt struct {
-	Name  string // 自定义名称(默认为函数名util.FuncFullNameRef)
-	Right bool   // 是否立刻执行(daily类:当天时间满足的话则执行)
-	Store bool   // 是否需要保存状态
+	Name     string         // 自定义名称(默认为函数名util.FuncFullNameRef)
+	Right    bool           // 是否立刻执行(daily类:当天时间满足的话则执行)
+	Store    bool           // 是否需要保存状态
+	Location *time.Location // 时区(daily与cron类, 默认time.Local)
+	Locker   ITimerLocker   // 分布式锁(多副本每次触发仅一个执行, 成功执行后通过ITimerRestorer记录; 固定间隔类按间隔边界对齐触发)
+
+	Overlap    ETimerOverlap // 上次执行未结束时的重叠策略(默认允许并发)
+	Timeout    time.Duration // 单次执行超时(通过ctx取消, 仅对响应ctx的JobHandler任务有效; Timer/Daily/CronHandler的函数不接收ctx, 执行完才记为超时; 0:不限制)
+	Retry      int           // 失败(错误,panic,超时)后的重试次数
+	RetryDelay time.Duration // 重试的初始退避时间(每次翻倍, 不超过C_TIMER_RETRY_MAX; 默认C_TIMER_RETRY_DELAY)
+}
+
+// ==================== 执行记录(环形缓冲)
+type timerRecords struct {
+	mutex util.Locker
+	ring  []*TimerRecord
+	pos   int
+	full  bool
+}
+
+func (r *timerRecords) init(size int) { r.ring = make([]*TimerRecord, size) }
+func (r *timerRecords) add(rec *TimerRecord) {
+	defer r.mutex.UnLock(r.mutex.Lock())
+	r.ring[r.pos] = rec
+	r.pos = (r.pos + 1) % len(r.ring)
+	r.full = r.full || r.pos == 0
+}
+
+// 按时间倒序返回(name为空则返回全部)
+func (r *timerRecords) list(name string) []*TimerRecord {
+	defer r.mutex.UnLock(r.mutex.Lock())
+
+	size := util.Tern(r.full, len(r.ring), r.pos)
+	recs := make([]*TimerRecord, 0, size)
+	for i := 1; i <= size; i++ {
+		rec := r.ring[(r.pos-i+len(r.ring))%len(r.ring)]
+		if name == "" || rec.Name == name {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// ==================== 内存锁(单进程/测试使用)
+func MemTimerLocker() ITimerLocker { return &memLocker{locks: map[string]time.Time{}} }
+
+type memLocker struct {
+	mutex util.Locker
+	locks map[string]time.Time // key => 过期时间
+}
+
+func (l *memLocker) TryLock(key string, ttl time.Duration) bool {
+	defer l.mutex.UnLock(l.mutex.Lock())
+
+	now := time.Now()
+	if expire, ok := l.locks[key]; ok && now.Before(expire) {
+		return false
+	}
+	for k, expire := range l.locks { // 清理过期的锁(key含触发时间, 不清理会持续增长)
+		util.Cast(!now.Before(expire), func() { delete(l.locks, k) }, nil)
+	}
+	l.locks[key] = now.Add(ttl)
+	return true
 }
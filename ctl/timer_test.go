@@ -0,0 +1,132 @@
+package ctl
+
+import (
+	"context"
+	"maps"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+func TestMemTimerLocker(t *testing.T) {
+	l := MemTimerLocker().(*memLocker)
+	if !l.TryLock("a", 50*time.Millisecond) {
+		t.Fatal("first lock should succeed")
+	}
+	if l.TryLock("a", 50*time.Millisecond) {
+		t.Fatal("second lock should fail before expire")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !l.TryLock("b", time.Second) {
+		t.Fatal("lock b should succeed")
+	}
+	if _, ok := l.locks["a"]; ok {
+		t.Fatal("expired lock a should be evicted")
+	}
+	if !l.TryLock("a", time.Second) {
+		t.Fatal("lock a should succeed after expire")
+	}
+}
+
+// 两个"副本"共用同一把锁, 每次触发仅执行一次, 且各自的last同步为最近一次成功执行
+func TestTimerLockerPerFire(t *testing.T) {
+	locker, restorer := MemTimerLocker(), &memRestorer{data: map[string]int64{}}
+	var runs atomic.Int32
+	job := func(ctx context.Context, now time.Time) (bool, error) { runs.Add(1); return true, nil }
+
+	replicas := []*timer{}
+	for i := 0; i < 2; i++ {
+		tm := (&timer{}).Init(10 * time.Millisecond)
+		if err := tm.JobHandler("@every 1s", job, &TimerOpt{Name: "job", Locker: locker}); err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, tm.Start(restorer))
+	}
+	time.Sleep(2500 * time.Millisecond)
+	for _, tm := range replicas {
+		tm.Close()
+	}
+
+	if n := runs.Load(); n < 2 || n > 3 {
+		t.Fatalf("expect one run per fire(2~3), got %d", n)
+	}
+	if _, ok := restorer.Load()["job"]; !ok {
+		t.Fatal("last success should be saved")
+	}
+}
+
+type memRestorer struct {
+	mutex util.Locker
+	data  map[string]int64
+}
+
+func (r *memRestorer) Load() map[string]int64 {
+	defer r.mutex.UnLock(r.mutex.Lock())
+	return maps.Clone(r.data)
+}
+func (r *memRestorer) Save(key string, valAt int64) {
+	defer r.mutex.UnLock(r.mutex.Lock())
+	r.data[key] = valAt
+}
+
+func TestTimerCloseTwice(t *testing.T) {
+	tm := (&timer{}).Init().Start()
+	tm.Close()
+	tm.Close()
+}
+
+func TestTimerRetryBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{0: time.Second, 3: 8 * time.Second, 64: C_TIMER_RETRY_MAX, 1000: C_TIMER_RETRY_MAX} {
+		if d := util.Backoff(time.Second, attempt, C_TIMER_RETRY_MAX); d != want {
+			t.Fatalf("attempt %d backoff %v, want %v", attempt, d, want)
+		}
+	}
+}
+
+func TestTimerLockKeyByApp(t *testing.T) {
+	tm := NewApp("svc-a", "").Timer().(*timer)
+	if key := lockKey(tm.owner(), "job", time.UnixMilli(1000)); key != "ulib:timer:svc-a:job:1000" {
+		t.Fatalf("lock key should use owner app name, got %q", key)
+	}
+	if (&timer{}).owner() != std {
+		t.Fatal("unbound timer should belong to default app")
+	}
+}
+
+func TestTimerRightOncePerWindow(t *testing.T) {
+	locker := MemTimerLocker()
+	var runs atomic.Int32
+	job := func(ctx context.Context, now time.Time) (bool, error) { runs.Add(1); return true, nil }
+
+	for i := 0; i < 2; i++ {
+		tm := (&timer{}).Init()
+		if err := tm.JobHandler("@every 1h", job, &TimerOpt{Name: "job", Right: true, Locker: locker}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(600 * time.Millisecond) // 超过C_TIMER_LOCK_TTL_MIN后启动的副本仍在同一窗口
+	}
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("expect one startup run per window, got %d", n)
+	}
+}
+
+func TestTimerQueuedRunAfterDelete(t *testing.T) {
+	var runs atomic.Int32
+	tm := (&timer{}).Init(5 * time.Millisecond)
+	tm.TimerHandler(20*time.Millisecond, func(now time.Time) bool {
+		runs.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return true
+	}, &TimerOpt{Name: "slow", Overlap: ETO_Queue})
+	tm.Start()
+	defer tm.Close()
+
+	time.Sleep(70 * time.Millisecond) // 首次执行中, 已有排队的一次
+	tm.DelHandlerByName("slow")
+	time.Sleep(200 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("queued run of deleted job should be dropped, got %d runs", n)
+	}
+}
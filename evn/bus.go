@@ -0,0 +1,167 @@
+package evn
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+// > 订阅句柄
+type Subscription struct {
+	bus *bus
+	sub *subscriber
+}
+
+// 取消订阅(可重复调用)
+func (s *Subscription) Cancel() {
+	if s == nil || !s.sub.canceled.CompareAndSwap(false, true) {
+		return
+	}
+	s.bus.remove(s.sub)
+}
+
+// 订阅的事件类型
+func (s *Subscription) Type() reflect.Type { return s.sub.typ }
+
+// ------------------------------------------------------------------------------
+type subscriber struct {
+	typ      reflect.Type
+	name     string
+	priority int
+	seq      uint64
+	handle   TEventHandlerE
+	reply    TCallHandler // 非nil表示应答者(仅响应Call)
+	canceled atomic.Bool
+}
+
+func (s *subscriber) respond(event IEvent) (ret interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			util.Catch(fmt.Sprintf("Responder[%s] handle event(%s) panic", s.name, event.EventId()), x)
+			ret, err = nil, fmt.Errorf("panic: %v", x)
+		}
+	}()
+	return s.reply(event)
+}
+
+// > 按事件类型分发的订阅表
+type bus struct {
+	util.RWLocker
+
+	seq    uint64
+	subs   map[reflect.Type][]*subscriber
+	cached map[reflect.Type][]*subscriber // 具体类型 -> 匹配的订阅者(含接口订阅)
+}
+
+func newBus() *bus {
+	return &bus{subs: map[reflect.Type][]*subscriber{}, cached: map[reflect.Type][]*subscriber{}}
+}
+
+func (this *bus) add(typ reflect.Type, handle TEventHandlerE, reply TCallHandler, opt *SubOpt) *Subscription {
+	defer this.UnLock(this.Lock())
+
+	opt = util.Tern(opt != nil, opt, &SubOpt{})
+	this.seq++
+	sub := &subscriber{typ: typ, name: typ.String(), priority: opt.Priority, seq: this.seq, handle: handle, reply: reply}
+	util.Cast(opt.Name != "", func() { sub.name = opt.Name }, nil)
+	this.subs[typ] = append(this.subs[typ], sub)
+	this.cached = map[reflect.Type][]*subscriber{}
+	return &Subscription{this, sub}
+}
+func (this *bus) remove(sub *subscriber) {
+	defer this.UnLock(this.Lock())
+
+	list := this.subs[sub.typ]
+	for i, s := range list {
+		if s == sub {
+			this.subs[sub.typ] = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	util.Cast(len(this.subs[sub.typ]) == 0, func() { delete(this.subs, sub.typ) }, nil)
+	this.cached = map[reflect.Type][]*subscriber{}
+}
+
+// 合并预订阅(共享订阅者, 已取消的在匹配时忽略)
+func (this *bus) merge(other *bus) {
+	if other == nil || other == this {
+		return
+	}
+	defer other.RUnLock(other.RLock())
+	defer this.UnLock(this.Lock())
+
+	for typ, list := range other.subs {
+		this.subs[typ] = append(this.subs[typ], list...)
+	}
+	this.seq = max(this.seq, other.seq)
+	this.cached = map[reflect.Type][]*subscriber{}
+}
+
+// 匹配事件的订阅者(按优先级降序, 相同则按订阅顺序)
+func (this *bus) match(typ reflect.Type) []*subscriber {
+	if list, ok := this.lookup(typ); ok {
+		return list
+	}
+
+	defer this.UnLock(this.Lock())
+	var list []*subscriber
+	for t, subs := range this.subs {
+		if t != typ && (t.Kind() != reflect.Interface || !typ.Implements(t)) {
+			continue
+		}
+		for _, sub := range subs {
+			util.Cast(!sub.canceled.Load(), func() { list = append(list, sub) }, nil)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].priority != list[j].priority {
+			return list[i].priority > list[j].priority
+		}
+		return list[i].seq < list[j].seq
+	})
+	this.cached[typ] = list
+	return list
+}
+
+func (this *bus) lookup(typ reflect.Type) ([]*subscriber, bool) {
+	defer this.RUnLock(this.RLock())
+	list, ok := this.cached[typ]
+	return list, ok
+}
+
+// 匹配事件的订阅者(不含应答者)
+func (this *bus) subscribers(event IEvent) []*subscriber {
+	list := []*subscriber{}
+	for _, s := range this.match(reflect.TypeOf(event)) {
+		util.Cast(s.reply == nil && !s.canceled.Load(), func() { list = append(list, s) }, nil)
+	}
+	return list
+}
+
+// 匹配事件的应答者
+func (this *bus) responders(event IEvent) []*subscriber {
+	list := []*subscriber{}
+	for _, s := range this.match(reflect.TypeOf(event)) {
+		util.Cast(s.reply != nil && !s.canceled.Load(), func() { list = append(list, s) }, nil)
+	}
+	return list
+}
+
+// 已订阅的事件类型
+func (this *bus) types() []string {
+	defer this.RUnLock(this.RLock())
+
+	names := make([]string, 0, len(this.subs))
+	for typ, list := range this.subs {
+		n := 0
+		for _, sub := range list {
+			util.Cast(!sub.canceled.Load(), func() { n++ }, nil)
+		}
+		util.Cast(n > 0, func() { names = append(names, fmt.Sprintf("%s(%d)", typ, n)) }, nil)
+	}
+	sort.Strings(names)
+	return names
+}
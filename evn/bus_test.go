@@ -0,0 +1,93 @@
+package evn
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudapex/ulib/ctl"
+)
+
+type otherEvent struct{}
+
+func (otherEvent) EventId() TEventID { return "test.other" }
+
+func startBus(t *testing.T, name string) *controller {
+	t.Helper()
+	app := ctl.NewApp(name, "")
+	c := app.Install(Controller(&Config{Size: 1})).(*controller)
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Stop() })
+	return c
+}
+
+// 订阅者按优先级降序执行, 相同优先级按订阅顺序
+func TestBusPriorityOrder(t *testing.T) {
+	c := startBus(t, "bus-order")
+
+	var mu sync.Mutex
+	order := []string{}
+	record := func(name string) func(testEvent) {
+		return func(testEvent) { mu.Lock(); order = append(order, name); mu.Unlock() }
+	}
+	SubscribeTo(c, record("low"), &SubOpt{Priority: -1})
+	SubscribeTo(c, record("first"))
+	SubscribeTo(c, record("high"), &SubOpt{Priority: 10})
+	SubscribeTo(c, record("second"))
+	SubscribeTo(c, func(IEvent) { mu.Lock(); order = append(order, "iface"); mu.Unlock() }, &SubOpt{Priority: 5})
+
+	c.Post(testEvent{}, true)
+	waitUntil(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(order) == 5 })
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(order, ","); got != "high,iface,first,second,low" {
+		t.Fatalf("unexpected order %q", got)
+	}
+}
+
+// 类型化订阅只接收对应类型, 接口订阅接收所有实现者, 取消后不再接收
+func TestBusTypedDispatch(t *testing.T) {
+	c := startBus(t, "bus-typed")
+
+	var mu sync.Mutex
+	got := map[string]int{}
+	count := func(name string) { mu.Lock(); got[name]++; mu.Unlock() }
+	typed := SubscribeTo(c, func(testEvent) { count("typed") })
+	SubscribeTo(c, func(otherEvent) { count("other") })
+	SubscribeTo(c, func(IEvent) { count("iface") })
+
+	c.Post(testEvent{}, true)
+	c.Post(otherEvent{}, true)
+	waitUntil(t, func() bool { mu.Lock(); defer mu.Unlock(); return got["iface"] == 2 })
+
+	typed.Cancel()
+	typed.Cancel() // 可重复调用
+	c.Post(testEvent{}, true)
+	waitUntil(t, func() bool { mu.Lock(); defer mu.Unlock(); return got["iface"] == 3 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got["typed"] != 1 || got["other"] != 1 {
+		t.Fatalf("unexpected dispatch %v", got)
+	}
+}
+
+// 应答者不接收投递, 订阅者不响应请求
+func TestBusRespondSeparated(t *testing.T) {
+	c := startBus(t, "bus-respond")
+
+	posted := make(chan struct{}, 1)
+	SubscribeTo(c, func(testEvent) { posted <- struct{}{} })
+	RespondTo(c, func(e testEvent) (int, error) { return e.n * 2, nil })
+
+	ret, err := c.Call(context.Background(), testEvent{n: 21})
+	if err != nil || ret != 42 {
+		t.Fatalf("unexpected call result %v err:%v", ret, err)
+	}
+	if len(posted) != 0 {
+		t.Fatal("subscriber should not handle calls")
+	}
+}
@@ -0,0 +1,104 @@
+package evn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+var (
+	typeLock  util.RWLocker
+	typeNames = map[reflect.Type]*eventType{} // 具体类型 -> 注册信息
+	typeByKey = map[string]*eventType{}       // 类型名 -> 注册信息
+)
+
+type eventType struct {
+	name    string
+	typ     reflect.Type
+	durable bool
+}
+
+// RegisterType 注册事件类型(用于持久化与跨进程传输时按类型名还原为具体类型, name默认为类型名)
+func RegisterType[T IEvent](name ...string) {
+	registerType(typeOf[T](), util.DefaultVal(name), false)
+}
+
+// Durable 注册需要持久化的事件类型(配置Config.Outbox后, 投递时先写入外发箱, 处理成功后确认)
+func Durable[T IEvent](name ...string) {
+	registerType(typeOf[T](), util.DefaultVal(name), true)
+}
+
+// TypeName 已注册事件的类型名
+func TypeName(event IEvent) (string, bool) {
+	et := lookupType(reflect.TypeOf(event))
+	if et == nil {
+		return "", false
+	}
+	return et.name, true
+}
+
+// Marshal 编码已注册的事件(json)
+func Marshal(event IEvent) (name string, data []byte, err error) {
+	et := lookupType(reflect.TypeOf(event))
+	if et == nil {
+		return "", nil, fmt.Errorf("event type %T not registered", event)
+	}
+	data, err = json.Marshal(event)
+	return et.name, data, err
+}
+
+// Unmarshal 按类型名解码事件(json)
+func Unmarshal(name string, data []byte) (IEvent, error) {
+	return UnmarshalWith(name, func(v interface{}) error { return json.Unmarshal(data, v) })
+}
+
+// UnmarshalWith 按类型名创建事件并由decode填充(供自定义编码使用, decode的参数为指针)
+func UnmarshalWith(name string, decode func(v interface{}) error) (IEvent, error) {
+	et := lookupName(name)
+	if et == nil {
+		return nil, fmt.Errorf("event type %q not registered", name)
+	}
+
+	var ptr reflect.Value
+	if et.typ.Kind() == reflect.Ptr {
+		ptr = reflect.New(et.typ.Elem())
+	} else {
+		ptr = reflect.New(et.typ)
+	}
+	if err := decode(ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("decode event %q err:%v", name, err)
+	}
+	if et.typ.Kind() == reflect.Ptr {
+		return ptr.Interface().(IEvent), nil
+	}
+	return ptr.Elem().Interface().(IEvent), nil
+}
+
+// ------------------------------------------------------------------------------
+func registerType(typ reflect.Type, name string, durable bool) {
+	if typ.Kind() == reflect.Interface {
+		panic(fmt.Sprintf("evn: register interface type %v", typ))
+	}
+	name = util.Tern(name == "", typ.String(), name)
+
+	defer typeLock.UnLock(typeLock.Lock())
+	if et, ok := typeByKey[name]; ok && et.typ != typ {
+		panic(fmt.Sprintf("evn: event type name %q already registered by %v", name, et.typ))
+	}
+	et := &eventType{name: name, typ: typ, durable: durable}
+	if old, ok := typeNames[typ]; ok {
+		delete(typeByKey, old.name)
+		et.durable = durable || old.durable
+	}
+	typeNames[typ], typeByKey[name] = et, et
+}
+func lookupType(typ reflect.Type) *eventType {
+	defer typeLock.RUnLock(typeLock.RLock())
+	return typeNames[typ]
+}
+func lookupName(name string) *eventType {
+	defer typeLock.RUnLock(typeLock.RLock())
+	return typeByKey[name]
+}
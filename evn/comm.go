@@ -1,6 +1,12 @@
 package evn
 
-import "github.com/cloudapex/ulib/ctl"
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+)
 
 // > 控制器接口
 type IContrler interface {
@@ -9,9 +15,48 @@ type IContrler interface {
 	// 监听事件(eventId重复则进行覆盖)
 	Listen(event IEvent, handle TEventHandler)
 
+	// 按事件类型订阅(同一类型可多个订阅者, typ为接口时匹配所有实现该接口的事件)
+	Subscribe(typ reflect.Type, handle TEventHandler, opt ...*SubOpt) *Subscription
+
+	// 按事件类型订阅(处理器返回错误)
+	SubscribeE(typ reflect.Type, handle TEventHandlerE, opt ...*SubOpt) *Subscription
+
+	// 添加全局中间件(作用于Listen,Subscribe,PostDo的每个处理器, 按添加顺序由外到内)
+	Use(mws ...TMiddleware)
+
+	// 添加指定事件Id的中间件(在全局中间件之后)
+	UseFor(id TEventID, mws ...TMiddleware)
+
+	// 按事件类型注册应答者(仅响应Call/CallAll, 同一类型可多个)
+	Respond(typ reflect.Type, handle TCallHandler, opt ...*SubOpt) *Subscription
+
+	// 异步请求(由优先级最高的应答者处理, 未开始前可取消)
+	Request(event IEvent, sync ...bool) *Future
+
+	// 请求并等待结果(ctx到期时取消尚未开始的请求; 在事件处理器内调用可能路由到自身所在任务而等到ctx到期)
+	Call(ctx context.Context, event IEvent) (interface{}, error)
+
+	// 请求所有应答者并收集结果(按优先级顺序)
+	CallAll(ctx context.Context, event IEvent) ([]*CallResult, error)
+
 	// 投递事件(sync:此时间是否需要被同步有序处理)
 	Post(event IEvent, sync ...bool)
 
+	// 尝试投递事件(按Config.Overflow策略处理, 返回未能入队的原因)
+	TryPost(event IEvent, sync ...bool) error
+
+	// 事务投递(durable事件在事务内写入外发箱, 提交后投递; 否则仅在提交后投递)
+	PostTx(tx ITx, event IEvent, sync ...bool) error
+
+	// 在指定时间投递(返回的句柄可取消)
+	PostAt(at time.Time, event IEvent, sync ...bool) *Delay
+
+	// 在指定时间后投递(返回的句柄可取消)
+	PostAfter(after time.Duration, event IEvent, sync ...bool) *Delay
+
+	// 广播事件到其他进程(经Config.Transport, 各消费组均会收到并投递给本地处理器)
+	Broadcast(event IEvent) error
+
 	// 投递事件并自动监听(sync:此时间是否需要被同步有序处理)
 	PostDo(event IEventDo, sync ...bool)
 }
@@ -23,6 +68,11 @@ type IEvent interface {
 	EventId() TEventID
 }
 
+// > 分区事件接口(相同分区键的事件由同一任务按序处理, 不同键之间并行)
+type IPartitioned interface {
+	PartitionKey() string
+}
+
 // > 事件(闭包)接口
 type IEventDo interface {
 	IEvent
@@ -32,6 +82,100 @@ type IEventDo interface {
 // 事件处理器原型
 type TEventHandler func(IEvent)
 
+// 事件处理器原型(返回错误, 可被中间件重试或转入死信)
+type TEventHandlerE func(IEvent) error
+
+// 事件处理中间件(调用c.Next()执行后续中间件及处理器)
+type TMiddleware func(c *Context) error
+
+// 事件应答者原型
+type TCallHandler func(IEvent) (interface{}, error)
+
+// ==================== Outbox
+
+// > 持久化外发箱(durable事件投递前写入, 处理成功后确认, 启动后重放启动前未确认的)
+type IOutbox interface {
+
+	// 写入
+	Push(rec *OutboxRecord) error
+
+	// 确认(删除)
+	Ack(id string) error
+
+	// 未确认的记录
+	Pending() ([]*OutboxRecord, error)
+}
+
+// > 支持认领的外发箱(多实例共用时, 只有认领成功的实例重放)
+type IOutboxClaimer interface {
+
+	// 认领(原子地以rec替换记录id, 返回是否由本次替换)
+	Claim(id string, rec *OutboxRecord) (bool, error)
+}
+
+// > 支持事务写入的外发箱
+type ITxOutbox interface {
+	IOutbox
+
+	// 在事务内写入(提交后才可见)
+	PushTx(tx ITx, rec *OutboxRecord) error
+}
+
+// > 事务接口(如*mdb.Session)
+type ITx interface {
+
+	// 提交成功后执行
+	Defer(f func())
+}
+
+// ==================== DeadLetter
+
+// > 死信接收器(如DeadLetters)
+type IDeadLetterSink interface {
+	Put(dl *DeadLetter)
+}
+
+// ==================== Delay
+
+// > 延迟事件存储(如evnrdb.DelayStore)
+type IDelayStore interface {
+
+	// 添加
+	Add(rec *DelayRecord) error
+
+	// 移除(已投递或已取消)
+	Remove(id string) error
+
+	// 所有未投递的记录
+	Load() ([]*DelayRecord, error)
+}
+
+// > 支持原子认领的延迟事件存储(多实例共用存储时只有认领成功的投递)
+type IDelayClaimer interface {
+
+	// 认领到期的记录(原子移除, 返回是否由本次移除)
+	Claim(id string) (bool, error)
+}
+
+// ==================== Transport
+
+// > 需在初始化时检查的外发箱, 延迟存储或传输(如evnrdb.StreamTransport)
+type IPreparer interface {
+
+	// 检查(返回错误则事件控制器初始化失败)
+	Prepare() error
+}
+
+// > 跨进程事件传输(如evnrdb.StreamTransport)
+type ITransport interface {
+
+	// 发送(事件类型需已注册)
+	Send(event IEvent) error
+
+	// 接收(阻塞直到ctx取消或出错; 处理成功后调用ack确认, 未确认的将被重新投递)
+	Recv(ctx context.Context, deliver func(event IEvent, ack func())) error
+}
+
 // ==================== Task
 type TaskHandler interface {
 	OnHandleTask(param interface{}) (ret interface{}, err error)
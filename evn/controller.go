@@ -1,53 +1,226 @@
 package evn
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/cloudapex/ulib/ctl"
 	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/met"
 	"github.com/cloudapex/ulib/util"
 
 	"golang.org/x/exp/rand"
 )
 
-func Controller(conf *Config) IContrler { return &controller{Conf: conf} }
+func Controller(conf *Config) IContrler {
+	return &controller{Conf: conf, handles: map[TEventID]TEventHandler{}, bus: newBus(), mwsFor: map[TEventID][]TMiddleware{}, delays: newDelayer()}
+}
 
 // > event controller
 type controller struct {
 	log.ILoger
+	ctl.AppBind
 	util.RWLocker
 
 	tasks []*Task
+	pool  *Task // 弹性池(处理无序事件, nil:未启用)
+
+	metCost  *met.HistogramVec // 事件处理耗时
+	metDrop  *met.CounterVec   // 被拒绝或丢弃的事件
+	metScale *met.CounterVec   // 弹性池扩缩容
+
+	delays *delayer // 延迟投递
+
+	metRemote  *met.CounterVec // 跨进程事件
+	recvCancel context.CancelFunc
+	recvDone   chan struct{}
 
 	handles map[TEventID]TEventHandler
+	bus     *bus // 按事件类型的订阅
+
+	mws    []TMiddleware              // 全局中间件
+	mwsFor map[TEventID][]TMiddleware // 按事件Id的中间件
+	ctx    context.Context            // 停止时取消(中间件的重试等待)
+	cancel context.CancelFunc
+
+	onceReplay sync.Once // 启动后重放外发箱的钩子只注册一次
+	startAt    time.Time // 初始化时间(只重放此前写入的外发箱记录)
+	onceMerge  sync.Once // 包级预注册只合并一次
 
 	Conf *Config
 }
 
 func (this *controller) HandleName() string { return "evn" }
 
+// 依赖外发箱, 传输与延迟存储所在的控制器(存储实现ctl.IDepender时)
+func (this *controller) HandleDepends() []string {
+	if this.Conf == nil {
+		return nil
+	}
+	deps, has := []string{}, map[string]bool{}
+	for _, it := range []interface{}{this.Conf.Outbox, this.Conf.Transport, this.Conf.Delay} {
+		d, ok := it.(ctl.IDepender)
+		if !ok {
+			continue
+		}
+		for _, name := range d.HandleDepends() {
+			util.Cast(!has[name], func() { has[name], deps = true, append(deps, name) }, nil)
+		}
+	}
+	return deps
+}
+
+// 检查存储与传输(实现IPreparer时)
+func (this *controller) prepare() error {
+	for _, it := range []interface{}{this.Conf.Outbox, this.Conf.Transport, this.Conf.Delay} {
+		if p, ok := it.(IPreparer); ok {
+			if err := p.Prepare(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 合并包级预注册(预注册的中间件在外层)
+func (this *controller) mergePre() {
+	func() {
+		defer this.UnLock(this.Lock())
+		for id, h := range units {
+			util.Cast(this.handles[id] == nil, func() { this.handles[id] = h }, nil)
+		}
+		this.mws = append(slices.Clone(uses), this.mws...)
+		for id, list := range usesFor {
+			this.mwsFor[id] = append(slices.Clone(list), this.mwsFor[id]...)
+		}
+	}()
+	this.bus.merge(subs)
+}
+
 func (this *controller) HandleInit() {
-	this.ILoger = ctl.Logger(this.HandleName())
+	if err := this.HandleInitE(); err != nil {
+		log.Fatal("init err:%v", err)
+	}
+}
+func (this *controller) HandleInitE() error {
+	this.ILoger = this.App().Logger(this.HandleName())
+	if this.Conf == nil {
+		return fmt.Errorf("conf = nil")
+	}
+	this.initMetrics()
+	if err := this.prepare(); err != nil {
+		return err
+	}
 
-	this.handles = map[TEventID]TEventHandler{}
-	util.Cast(this.Conf == nil, func() { log.Fatal("conf = nil") }, nil)
-	util.Cast(len(units) != 0, func() { this.handles = units }, nil)
+	if this.App() == ctl.Default() { // 包级预注册仅属于默认应用(不覆盖初始化前Listen的), 重新初始化时不重复合并
+		this.onceMerge.Do(this.mergePre)
+	}
 
 	this.Conf.revise()
+	this.ctx, this.cancel = context.WithCancel(context.Background())
+	this.startAt = time.Now()
 
 	// init tasks
 	this.TraceD(-1, "Start add task(%d)...", this.Conf.Size)
 	defer this.InfoD(-1, "Add Task(%d) done.", this.Conf.Size)
 
+	this.tasks = nil
 	for n := 0; n < this.Conf.Size; n++ {
-		this.tasks = append(this.tasks, (&Task{}).Init(fmt.Sprintf("%s-%d", this.HandleName(), n), this.Conf.Capy))
-		this.tasks[n].Handler(this)
+		this.tasks = append(this.tasks, this.newTask(fmt.Sprintf("%s-%d", this.HandleName(), n), this.Conf.taskOpt()))
+	}
+	this.pool = nil
+	if this.Conf.MaxWorkers > 0 {
+		name, opt := this.HandleName()+"-pool", this.Conf.taskOpt()
+		opt.MaxWorkers, opt.IdleTime, opt.GrowRate = this.Conf.MaxWorkers, time.Duration(this.Conf.IdleTime)*time.Second, this.Conf.GrowRate
+		opt.OnScale = func(workers int, grow bool) { this.onScale(name, workers, grow) }
+		this.pool = this.newTask(name, opt)
 	}
+	this.onceReplay.Do(func() { this.App().OnStarted(this.replay, &ctl.HookOpt{Name: "evn.replay"}) })
+	this.startRecv()
+
+	this.delays.reset(this.Conf.Delay, this.fireDelay, this.Error)
+	this.loadDelays()
+	this.delays.start(this.HandleName() + ".delay")
+	return nil
 }
 func (this *controller) HandleTerm() {
+	ctx, cancel := context.WithTimeout(context.Background(), C_TASK_EXIT_TIME_OUT)
+	defer cancel()
+	util.Cast(this.HandleTermC(ctx) != nil, func() { this.Error("term exit timeout") }, nil)
+}
+
+// 关闭(ctx为应用关闭预算, 接收协程, 延迟投递与各任务共享其期限)
+func (this *controller) HandleTermC(ctx context.Context) error {
+	errs := []error{}
+	util.Cast(this.cancel != nil, this.cancel, nil)
+	util.Cast(this.stopRecv(ctx) != nil, func() { errs = append(errs, fmt.Errorf("transport recv exit timeout")) }, nil)
+	util.Cast(this.delays.stop(ctx) != nil, func() { errs = append(errs, fmt.Errorf("delayer exit timeout")) }, nil)
+	for _, t := range this.allTasks() {
+		util.Cast(t.ExitC(ctx) != nil, func() { errs = append(errs, fmt.Errorf("task[%q] exit timeout", t.name)) }, nil)
+	}
+	return errors.Join(errs...)
+}
+
+func (this *controller) HandleHealth(ctx context.Context) (string, error) {
+	size, capy := 0, 0
+	for _, t := range this.allTasks() {
+		size, capy = size+t.Len(), capy+t.Cap()
+	}
+	detail := fmt.Sprintf("tasks:%d backlog:%d/%d", len(this.tasks), size, capy)
+	if p := this.pool; p != nil {
+		detail += fmt.Sprintf(" pool:%d/%d workers", p.Workers(), this.Conf.MaxWorkers)
+	}
+	if capy > 0 && size >= capy*C_TASK_BACKLOG_RATE/100 {
+		return detail, fmt.Errorf("task queues backed up")
+	}
+	return detail, nil
+}
+
+func (this *controller) initMetrics() {
+	m := ctl.Metrics(this.HandleName())
+	this.metCost = m.NewHistogram("handle_seconds", "Event handler duration by event id.", nil, "app", "event")
+	this.metDrop = m.NewCounter("dropped_total", "Events rejected or dropped by overflow policy.", "app", "task", "reason")
+	this.metRemote = m.NewCounter("remote_total", "Events sent to or received from other processes.", "app", "op")
+	this.metScale = m.NewCounter("worker_scale_total", "Elastic pool workers spawned or retired.", "app", "task", "op")
+	workers := m.NewGauge("workers", "Running workers per task.", "app", "task")
+	depth := m.NewGauge("queue_depth", "Queued events per task (including spilled).", "app", "task")
+	capy := m.NewGauge("queue_capacity", "Queue capacity per task.", "app", "task")
+	delayed := m.NewGauge("delayed_events", "Events waiting for delayed delivery.", "app")
+	app := this.App().Name()
+	this.App().Collect(m, "queue", func() {
+		for _, t := range this.allTasks() {
+			depth.With(app, t.name).Set(float64(t.Len()))
+			capy.With(app, t.name).Set(float64(t.Cap()))
+			workers.With(app, t.name).Set(float64(t.Workers()))
+		}
+		delayed.With(app).Set(float64(this.delays.len()))
+	})
+}
+func (this *controller) HandleInspect() interface{} {
+	defer this.RUnLock(this.RLock())
+
+	ids := make([]string, 0, len(this.handles))
+	for id := range this.handles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	backlogs, spilled := make([]int, 0, len(this.tasks)), 0
 	for _, t := range this.tasks {
-		t.Exit()
+		backlogs, spilled = append(backlogs, t.Len()), spilled+t.Spilled()
 	}
+	info := map[string]interface{}{"tasks": len(this.tasks), "capy": this.Conf.Capy, "overflow": this.Conf.Overflow, "backlogs": backlogs, "spilled": spilled, "delayed": this.delays.len(), "handlers": ids, "subscribers": this.bus.types()}
+	if p := this.pool; p != nil {
+		info["pool"] = map[string]interface{}{"workers": p.Workers(), "maxWorkers": this.Conf.MaxWorkers, "spawned": p.Spawned(), "retired": p.Retired(), "backlog": p.Len(), "spilled": p.Spilled()}
+	}
+	return info
 }
 
 //  ==================== Functions
@@ -60,15 +233,103 @@ func (this *controller) Listen(event IEvent, handle TEventHandler) {
 	this.handles[event.EventId()] = handle
 }
 
-// 投递事件(orderly:是否需要被有序处理)
+// 按事件类型订阅
+func (this *controller) Subscribe(typ reflect.Type, handle TEventHandler, opt ...*SubOpt) *Subscription {
+	return this.bus.add(typ, func(e IEvent) error { handle(e); return nil }, nil, util.DefaultVal(opt))
+}
+
+// 按事件类型订阅(处理器返回错误)
+func (this *controller) SubscribeE(typ reflect.Type, handle TEventHandlerE, opt ...*SubOpt) *Subscription {
+	return this.bus.add(typ, handle, nil, util.DefaultVal(opt))
+}
+
+// 添加全局中间件
+func (this *controller) Use(mws ...TMiddleware) {
+	defer this.UnLock(this.Lock())
+	this.mws = append(this.mws, mws...)
+}
+
+// 添加指定事件Id的中间件
+func (this *controller) UseFor(id TEventID, mws ...TMiddleware) {
+	defer this.UnLock(this.Lock())
+	this.mwsFor[id] = append(this.mwsFor[id], mws...)
+}
+
+// 按事件类型注册应答者
+func (this *controller) Respond(typ reflect.Type, handle TCallHandler, opt ...*SubOpt) *Subscription {
+	return this.bus.add(typ, nil, handle, util.DefaultVal(opt))
+}
+
+// 异步请求(orderly:是否需要被有序处理)
+func (this *controller) Request(event IEvent, orderly ...bool) *Future {
+	task, err := this.route(event, util.DefaultVal(orderly))
+	if err != nil {
+		f := newFuture()
+		f.complete(nil, err)
+		return f
+	}
+	return task.Go(&callReq{event: event})
+}
+
+// 请求并等待结果
+func (this *controller) Call(ctx context.Context, event IEvent) (interface{}, error) {
+	task, err := this.route(event, false)
+	if err != nil {
+		return nil, err
+	}
+	return task.Call(ctx, &callReq{event: event})
+}
+
+// 请求所有应答者并收集结果
+func (this *controller) CallAll(ctx context.Context, event IEvent) ([]*CallResult, error) {
+	task, err := this.route(event, false)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := task.Call(ctx, &callReq{event: event, all: true})
+	if err != nil {
+		return nil, err
+	}
+	return ret.([]*CallResult), nil
+}
+
+// 投递事件(orderly:是否需要被有序处理; 实现IPartitioned的事件按分区键有序)
 func (this *controller) Post(event IEvent, orderly ...bool) {
-	// 有序事件使用tasks[0]
-	if util.DefaultVal(orderly) {
-		this.tasks[0].Post(event)
+	if len(this.tasks) == 0 { // 未初始化(ILoger与外发箱均不可用)
+		this.App().Logger(this.HandleName()).Error("post event:%q err:%v", event.EventId(), ErrNotInited)
 		return
 	}
-	// 有序事件使用其他tasks
-	this.tasks[rand.Intn(len(this.tasks)-1)+1].Post(event)
+	this.post(event, util.DefaultVal(orderly), this.persist(event, util.DefaultVal(orderly)))
+}
+
+// 尝试投递事件(按溢出策略处理, 返回未能入队的原因)
+func (this *controller) TryPost(event IEvent, orderly ...bool) error {
+	task, err := this.route(event, util.DefaultVal(orderly))
+	if err != nil {
+		return err
+	}
+	id := this.persist(event, util.DefaultVal(orderly))
+	if id == "" {
+		return task.TryPost(event)
+	}
+	err = task.TryPost(event, this.acker(event, id))
+	util.Cast(err != nil, func() { this.ack(id) }, nil) // 调用方已知失败, 不再重放
+	return err
+}
+
+// 事务投递(durable事件在事务内写入外发箱, 提交后投递; 否则仅在提交后投递)
+func (this *controller) PostTx(tx ITx, event IEvent, orderly ...bool) error {
+	box, ok := this.Conf.Outbox.(ITxOutbox)
+	rec := this.record(event, util.DefaultVal(orderly))
+	if !ok || rec == nil {
+		tx.Defer(func() { this.Post(event, orderly...) })
+		return nil
+	}
+	if err := box.PushTx(tx, rec); err != nil {
+		return err
+	}
+	tx.Defer(func() { this.post(event, rec.Orderly, rec.Id) })
+	return nil
 }
 
 // 投递事件并自动监听(orderly:是否需要被有序处理)
@@ -78,15 +339,128 @@ func (this *controller) PostDo(event IEventDo, orderly ...bool) {
 
 //  ==================== TaskHandle
 func (this *controller) OnHandleTask(param interface{}) (ret interface{}, err error) {
+	if req, ok := param.(*callReq); ok {
+		return this.call(req)
+	}
+
 	event := param.(IEvent)
+	defer this.metCost.With(this.App().Name(), event.EventId()).ObserveSince(time.Now())
 	if eventDo, ok := event.(IEventDo); ok {
-		eventDo.Do()
-		return nil, nil
+		return nil, this.invoke(event, "do", func(IEvent) error { eventDo.Do(); return nil })
 	}
 
-	defer this.RUnLock(this.RLock())
-	hander, ok := this.handles[event.EventId()]
-	util.Cast(ok, func() { hander(param.(IEvent)) }, func() { this.ErrorD(-1, "EventHandle not found for event:%#v", event) })
+	errs := []error{}
+	hander, ok := this.handler(event.EventId())
+	if ok {
+		errs = append(errs, this.invoke(event, event.EventId(), func(e IEvent) error { hander(e); return nil }))
+	}
+	subs := this.bus.subscribers(event)
+	for _, s := range subs {
+		errs = append(errs, this.invoke(event, s.name, s.handle))
+	}
+	if !ok && len(subs) == 0 {
+		return nil, ErrNoHandler // 未被处理则不确认(外发箱保留待重放)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// ------------------------------------------------------------------------------
+type callReq struct {
+	event IEvent
+	all   bool
+}
+
+func (this *controller) call(req *callReq) (interface{}, error) {
+	defer this.metCost.With(this.App().Name(), req.event.EventId()).ObserveSince(time.Now())
+
+	subs := this.bus.responders(req.event)
+	if len(subs) == 0 {
+		return nil, ErrNoResponder
+	}
+	if !req.all {
+		return subs[0].respond(req.event)
+	}
+	rets := make([]*CallResult, 0, len(subs))
+	for _, s := range subs {
+		ret, err := s.respond(req.event)
+		rets = append(rets, &CallResult{s.name, ret, err})
+	}
+	return rets, nil
+}
+
+func (this *controller) fireDelay(d *Delay) {
+	this.Post(d.event, d.orderly)
+}
+
+// 选择任务: 分区事件按键哈希到tasks[1:](仅一个固定任务时为tasks[0]), 有序事件使用tasks[0], 其他使用弹性池(未启用则随机使用tasks[1:]); 未初始化返回ErrNotInited
+func (this *controller) route(event IEvent, orderly bool) (*Task, error) {
+	if len(this.tasks) == 0 {
+		return nil, ErrNotInited
+	}
+	if p, ok := event.(IPartitioned); ok {
+		if key := p.PartitionKey(); key != "" {
+			parts := util.Tern(len(this.tasks) > 1, this.tasks[1:], this.tasks) // 不与有序事件共用tasks[0]
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			return parts[h.Sum32()%uint32(len(parts))], nil
+		}
+	}
+	if orderly {
+		return this.tasks[0], nil
+	}
+	if this.pool != nil {
+		return this.pool, nil
+	}
+	return this.tasks[rand.Intn(len(this.tasks)-1)+1], nil
+}
+
+func (this *controller) newTask(name string, opt *TaskOpt) *Task {
+	opt.OnDrop = func(param interface{}, err error) { this.onDrop(name, param, err) }
+	t := (&Task{}).Init(name, this.Conf.Capy, opt)
+	t.Handler(this)
+	return t
+}
+func (this *controller) allTasks() []*Task {
+	if this.pool == nil {
+		return this.tasks
+	}
+	return append(this.tasks[:len(this.tasks):len(this.tasks)], this.pool)
+}
+func (this *controller) onScale(task string, workers int, grow bool) {
+	this.metScale.With(this.App().Name(), task, util.Tern(grow, "spawn", "retire")).Inc()
+	this.DebugD(-1, "Task[%q] %s worker, now:%d", task, util.Tern(grow, "spawn", "retire"), workers)
+}
 
-	return nil, nil
+var dropReasons = map[error]string{ErrQueueFull: "full", ErrQueueTimeout: "timeout", ErrQueueEvicted: "evicted"}
+
+func (this *controller) onDrop(task string, param interface{}, err error) {
+	reason, ok := dropReasons[err]
+	this.metDrop.With(this.App().Name(), task, util.Tern(ok, reason, "other")).Inc()
+	if event, ok := param.(IEvent); ok {
+		this.DebugD(-1, "Task[%q] drop event:%q err:%v", task, event.EventId(), err)
+	}
+}
+
+// 经中间件链执行单个处理器(panic仅记录, 不影响其他处理器)
+func (this *controller) invoke(event IEvent, name string, handle TEventHandlerE) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			util.Catch(fmt.Sprintf("Handler[%s] handle event(%s) panic", name, event.EventId()), x)
+			err = fmt.Errorf("handler[%s] panic: %v", name, x)
+		}
+	}()
+	c := &Context{Context: this.ctx, Event: event, Handler: name, app: this.App().Name(), logger: this.ILoger, chain: this.chain(event.EventId()), index: -1, final: handle}
+	if err = c.Next(); err != nil {
+		err = fmt.Errorf("handler[%s] %w", name, err)
+	}
+	return err
+}
+func (this *controller) chain(id TEventID) []TMiddleware {
+	defer this.RUnLock(this.RLock())
+	return append(this.mws[:len(this.mws):len(this.mws)], this.mwsFor[id]...)
+}
+func (this *controller) handler(id TEventID) (TEventHandler, bool) {
+	defer this.RUnLock(this.RLock())
+	h, ok := this.handles[id]
+	return h, ok
 }
@@ -1,20 +1,98 @@
 package evn
 
 import (
+	"errors"
 	"time"
 
+	"github.com/cloudapex/ulib/util"
+
 	"github.com/duke-git/lancet/v2/mathutil"
 )
 
-const C_TASK_EXIT_TIME_OUT = 2 * time.Second // task  退出超时
+const (
+	C_TASK_EXIT_TIME_OUT = 2 * time.Second        // task  退出超时(Task.Exit与直接调用HandleTerm时; 应用关闭时使用关闭预算)
+	C_TASK_BACKLOG_RATE  = 80                     // task队列积压百分比(超过则视为不健康)
+	C_TASK_WARN_INTERVAL = 1 * time.Minute        // task队列积压告警间隔
+	C_TASK_SPILL_TIMES   = 10                     // 溢出队列默认容量(相对通道能力的倍数)
+	C_RECV_RETRY_DELAY   = 3 * time.Second        // 传输接收出错后的重试间隔
+	C_DELAY_MAX_SLEEP    = 1 * time.Minute        // 延迟队列最长休眠时间
+	C_OUTBOX_LEASE       = 30 * time.Second       // 外发箱记录未确认超过此时间才可被其他实例认领重放
+	C_DEAD_LETTER_SIZE   = 256                    // 内存死信默认保留数量
+	C_RETRY_MAX_BACKOFF  = 1 * time.Minute        // 中间件重试的最长间隔
+	C_TASK_GROW_INTERVAL = 100 * time.Millisecond // 弹性任务两次扩容的最小间隔
+	C_WORKER_IDLE_TIME   = 30                     // 弹性任务工作协程默认空闲时间(秒)
+	C_WORKER_GROW_RATE   = 50                     // 弹性任务默认扩容的队列使用率(百分比)
+)
+
+var (
+	ErrTaskClosed   = errors.New("task not running")
+	ErrQueueFull    = errors.New("task queue full")
+	ErrQueueTimeout = errors.New("task queue post timeout")
+	ErrQueueEvicted = errors.New("task evicted by newer one")
+	ErrNoTransport  = errors.New("transport not configured")
+	ErrTaskCanceled = errors.New("task canceled")
+	ErrNoResponder  = errors.New("no responder for event")
+	ErrNoHandler    = errors.New("no handler for event")
+	ErrNotInited    = errors.New("controller not initialized")
+)
 
 type Config struct {
-	Size int // 处理事件的任务数量
+	Size int // 处理事件的任务数量(默认至少5; 启用弹性池时固定任务仅处理有序/分区事件, 至少1)
 	Capy int // 每个任务的通道能力
+
+	Overflow     EOverflow // 队列满时的策略(默认EOV_Block)
+	BlockTimeout int       // EOV_Block: 等待超时(毫秒, 0:一直等待)
+	SpillCapy    int       // EOV_Spill: 溢出队列容量(默认Capy*C_TASK_SPILL_TIMES)
+	WarnRate     int       // 队列使用率(百分比)达到时告警(默认C_TASK_BACKLOG_RATE)
+
+	MaxWorkers int // 弹性池最大工作协程数(>0时无序事件由弹性池处理, 有序/分区事件仍使用固定任务)
+	IdleTime   int // 弹性池工作协程空闲多久后退出(秒, 默认C_WORKER_IDLE_TIME)
+	GrowRate   int // 弹性池队列使用率(百分比)达到时扩容(默认C_WORKER_GROW_RATE)
+
+	Outbox    IOutbox     `json:"-"` // 持久化外发箱(如evnrdb.EventOutbox, evnmdb.EventOutbox; nil:不持久化)
+	Transport ITransport  `json:"-"` // 跨进程传输(如evnrdb.StreamTransport; nil:仅进程内)
+	Delay     IDelayStore `json:"-"` // 延迟事件存储(如evnrdb.DelayStore; nil:仅内存, 重启后丢失)
 } //
 func (c *Config) revise() {
-	c.Size = mathutil.Max(c.Size, 5)
+	c.Size = util.Tern(c.MaxWorkers > 0, mathutil.Max(c.Size, 1), mathutil.Max(c.Size, 5))
 	c.Capy = mathutil.Max(c.Capy, 100)
+	c.Overflow = util.Tern(c.Overflow == "", EOV_Block, c.Overflow)
+	c.SpillCapy = util.Tern(c.SpillCapy <= 0, c.Capy*C_TASK_SPILL_TIMES, c.SpillCapy)
+	c.WarnRate = util.Tern(c.WarnRate <= 0 || c.WarnRate > 100, C_TASK_BACKLOG_RATE, c.WarnRate)
+	c.IdleTime = util.Tern(c.IdleTime <= 0, C_WORKER_IDLE_TIME, c.IdleTime)
+	c.GrowRate = util.Tern(c.GrowRate <= 0 || c.GrowRate > 100, C_WORKER_GROW_RATE, c.GrowRate)
+}
+func (c *Config) taskOpt() *TaskOpt {
+	return &TaskOpt{Overflow: c.Overflow, Timeout: time.Duration(c.BlockTimeout) * time.Millisecond, SpillCapy: c.SpillCapy, WarnRate: c.WarnRate}
+}
+
+// 队列溢出策略
+type EOverflow string //
+const (
+	EOV_Block      EOverflow = "block"      // 阻塞等待(可设超时)
+	EOV_DropNewest EOverflow = "dropNewest" // 丢弃新投递的
+	EOV_DropOldest EOverflow = "dropOldest" // 丢弃最早排队的
+	EOV_Spill      EOverflow = "spill"      // 转入溢出队列(满则丢弃新投递的)
+)
+
+// Task选项
+type TaskOpt struct {
+	Overflow  EOverflow
+	Timeout   time.Duration                      // EOV_Block: 等待超时(0:一直等待)
+	SpillCapy int                                // EOV_Spill: 溢出队列容量
+	WarnRate  int                                // 队列使用率(百分比)达到时告警(0:不告警)
+	OnDrop    func(param interface{}, err error) // 任务被拒绝或丢弃时回调
+
+	MaxWorkers int                          // 弹性: 最大工作协程数(<=1:单协程)
+	IdleTime   time.Duration                // 弹性: 工作协程空闲超时后退出(至少保留一个)
+	GrowRate   int                          // 弹性: 队列使用率(百分比)达到时扩容
+	OnScale    func(workers int, grow bool) // 弹性: 扩容或缩容后回调
+}
+
+// 订阅选项
+type SubOpt struct {
+	Name     string // 名称(用于日志, 默认为事件类型名)
+	Priority int    // 优先级(越大越先执行, 相同则按订阅顺序)
 }
 
 // 事件Id类型
@@ -26,6 +104,14 @@ type Event struct {
 }                                  //
 func (e *Event) EventId() TEventID { return e.Id }
 
+// 分区事件基本结构(相同Key有序处理)
+type PartEvent struct {
+	Id  TEventID
+	Key string
+}                                         //
+func (e *PartEvent) EventId() TEventID    { return e.Id }
+func (e *PartEvent) PartitionKey() string { return e.Key }
+
 // 事件(闭包)结构(供业务继承)
 func EventDoFun(do func()) EventDo { return EventDo{Fun: do} }
 
@@ -36,8 +122,43 @@ type EventDo struct {
 func (e *EventDo) Do()               { e.Fun() }
 func (e *EventDo) EventId() TEventID { return e.Id }
 
+// 死信(重试后仍处理失败的事件)
+type DeadLetter struct {
+	Event   IEvent    `json:"event"`
+	Handler string    `json:"handler"`
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// 应答结果
+type CallResult struct {
+	Name   string      // 应答者名称
+	Result interface{} //
+	Err    error       //
+}
+
+// 外发箱记录
+type OutboxRecord struct {
+	Id      string `json:"id"`                // 按时间有序
+	Type    string `json:"type"`              // 注册的事件类型名
+	Data    []byte `json:"data"`              // json
+	Orderly bool   `json:"orderly,omitempty"` // 是否有序事件
+	At      int64  `json:"at"`                // 写入时间(毫秒)
+}
+
+// 延迟事件记录
+type DelayRecord struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`              // 注册的事件类型名
+	Data    []byte `json:"data"`              // json
+	Orderly bool   `json:"orderly,omitempty"` // 是否有序事件
+	FireAt  int64  `json:"fireAt"`            // 投递时间(毫秒)
+}
+
 // Task结构
 type task struct {
 	param   interface{}
 	donefun func(result interface{}, err error)
+	future  *Future
 }
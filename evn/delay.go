@@ -0,0 +1,267 @@
+package evn
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+// > 延迟投递句柄
+type Delay struct {
+	id      string
+	at      time.Time
+	event   IEvent
+	orderly bool
+	stored  bool // 已持久化
+	index   int  // 堆中位置(-1:已出堆)
+	owner   *delayer
+}
+
+func (d *Delay) Id() string    { return d.id }
+func (d *Delay) At() time.Time { return d.at }
+func (d *Delay) Event() IEvent { return d.event }
+func (d *Delay) Pending() bool { return d.owner.pending(d) }
+func (d *Delay) String() string {
+	return fmt.Sprintf("Delay[%s %s@%s]", d.id, d.event.EventId(), d.at.Format(time.RFC3339))
+}
+func (d *Delay) Cancel() bool             { return d.owner.cancel(d) } // 取消尚未投递的(返回是否取消成功)
+func (d *Delay) isDue(now time.Time) bool { return !d.at.After(now) }
+
+// ------------------------------------------------------------------------------
+type delayHeap []*Delay
+
+func (h delayHeap) Len() int           { return len(h) }
+func (h delayHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h delayHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i]; h[i].index, h[j].index = i, j }
+func (h *delayHeap) Push(x interface{}) {
+	d := x.(*Delay)
+	d.index = len(*h)
+	*h = append(*h, d)
+}
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	old[len(old)-1], d.index = nil, -1
+	*h = old[:len(old)-1]
+	return d
+}
+
+// > 延迟队列(最小堆, 单协程按最早到期时间唤醒)
+type delayer struct {
+	util.Locker
+	items   delayHeap
+	wake    chan struct{}
+	exit    chan struct{}
+	done    chan struct{}
+	running bool
+	store   IDelayStore
+	fire    func(d *Delay)
+	fail    func(format string, v ...interface{})
+}
+
+func newDelayer() *delayer { return &delayer{wake: make(chan struct{}, 1)} }
+
+// 初始化时调用: 丢弃上次运行已持久化的(将从存储恢复), 保留仅在内存中的
+func (this *delayer) reset(store IDelayStore, fire func(d *Delay), fail func(format string, v ...interface{})) {
+	defer this.UnLock(this.Lock())
+	items := this.items[:0]
+	for _, d := range this.items {
+		if d.stored {
+			d.index = -1
+			continue
+		}
+		d.index, items = len(items), append(items, d)
+	}
+	clear(this.items[len(items):])
+	this.items = items
+	heap.Init(&this.items)
+	this.exit, this.done = make(chan struct{}), make(chan struct{})
+	this.store, this.fire, this.fail = store, fire, fail
+}
+
+func (this *delayer) setRunning(running bool) (was bool) {
+	defer this.UnLock(this.Lock())
+	was, this.running = this.running, running
+	return
+}
+
+// 是否可持久化(已启动且配置了存储)
+func (this *delayer) persistent() bool {
+	defer this.UnLock(this.Lock())
+	return this.running && this.store != nil
+}
+
+func (this *delayer) add(d *Delay) {
+	d.owner = this
+	first := func() bool {
+		defer this.UnLock(this.Lock())
+		heap.Push(&this.items, d)
+		return d.index == 0
+	}()
+	if first || d.isDue(time.Now()) {
+		this.notify()
+	}
+}
+func (this *delayer) cancel(d *Delay) bool {
+	ok := func() bool {
+		defer this.UnLock(this.Lock())
+		if d.index < 0 {
+			return false
+		}
+		heap.Remove(&this.items, d.index)
+		return true
+	}()
+	util.Cast(ok, func() { this.remove(d) }, nil)
+	return ok
+}
+func (this *delayer) remove(d *Delay) {
+	if !d.stored {
+		return
+	}
+	if err := this.store.Remove(d.id); err != nil {
+		this.fail("delay store remove %q err:%v", d.id, err)
+	}
+}
+func (this *delayer) pending(d *Delay) bool {
+	defer this.UnLock(this.Lock())
+	return d.index >= 0
+}
+func (this *delayer) len() int {
+	if this == nil {
+		return 0
+	}
+	defer this.UnLock(this.Lock())
+	return len(this.items)
+}
+func (this *delayer) notify() {
+	select {
+	case this.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 取出所有到期的, 返回下次唤醒时间
+func (this *delayer) due(now time.Time) ([]*Delay, time.Duration) {
+	defer this.UnLock(this.Lock())
+	list := []*Delay{}
+	for len(this.items) > 0 && this.items[0].isDue(now) {
+		list = append(list, heap.Pop(&this.items).(*Delay))
+	}
+	if len(this.items) == 0 {
+		return list, C_DELAY_MAX_SLEEP
+	}
+	return list, min(this.items[0].at.Sub(now), C_DELAY_MAX_SLEEP)
+}
+
+// 认领到期的(存储实现IDelayClaimer时原子移除, 只有认领成功的实例投递; 否则投递后移除)
+func (this *delayer) claim(d *Delay) bool {
+	c, ok := this.store.(IDelayClaimer)
+	if !d.stored || !ok {
+		defer this.remove(d)
+		return true
+	}
+	won, err := c.Claim(d.id)
+	if err != nil {
+		this.fail("delay store claim %q err:%v", d.id, err)
+		return true // 无法认领时仍投递
+	}
+	return won
+}
+
+func (this *delayer) start(name string) {
+	this.setRunning(true)
+	util.Goroutine(name, func() {
+		defer close(this.done)
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-this.exit:
+				return
+			case <-this.wake:
+			case <-timer.C:
+			}
+			list, sleep := this.due(time.Now())
+			for _, d := range list {
+				if this.claim(d) {
+					this.fire(d)
+				}
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(sleep)
+		}
+	})
+}
+func (this *delayer) stop(ctx context.Context) error {
+	if !this.setRunning(false) {
+		return nil
+	}
+	close(this.exit)
+	select {
+	case <-this.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ==================== controller
+
+// 延迟投递(store非nil且事件类型已注册时持久化; 初始化前投递的仅保存在内存中, 启动后到期投递)
+func (this *controller) PostAt(at time.Time, event IEvent, orderly ...bool) *Delay {
+	d := &Delay{id: outboxId(), at: at, event: event, orderly: util.DefaultVal(orderly), index: -1}
+	if this.delays.persistent() {
+		d.stored = this.saveDelay(d)
+	}
+	this.delays.add(d)
+	return d
+}
+func (this *controller) PostAfter(after time.Duration, event IEvent, orderly ...bool) *Delay {
+	return this.PostAt(time.Now().Add(after), event, orderly...)
+}
+
+func (this *controller) saveDelay(d *Delay) bool {
+	if lookupType(reflect.TypeOf(d.event)) == nil {
+		this.Warn("delay event:%q type %T not registered, kept in memory only", d.event.EventId(), d.event)
+		return false
+	}
+	name, data, err := Marshal(d.event)
+	if err == nil {
+		err = this.Conf.Delay.Add(&DelayRecord{Id: d.id, Type: name, Data: data, Orderly: d.orderly, FireAt: d.at.UnixMilli()})
+	}
+	if err != nil {
+		this.Error("delay store add event:%q err:%v", d.event.EventId(), err)
+		return false
+	}
+	return true
+}
+
+// 恢复持久化的延迟事件(已到期的立即投递)
+func (this *controller) loadDelays() {
+	if this.Conf.Delay == nil {
+		return
+	}
+	recs, err := this.Conf.Delay.Load()
+	if err != nil {
+		this.Error("delay store load err:%v", err)
+		return
+	}
+	for _, rec := range recs {
+		event, err := Unmarshal(rec.Type, rec.Data)
+		if err != nil {
+			this.Error("delay store restore %q err:%v", rec.Id, err)
+			continue
+		}
+		this.delays.add(&Delay{id: rec.Id, at: time.UnixMilli(rec.FireAt), event: event, orderly: rec.Orderly, stored: true, index: -1})
+	}
+	util.Cast(len(recs) > 0, func() { this.Info("delay store restore %d events", len(recs)) }, nil)
+}
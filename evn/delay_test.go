@@ -0,0 +1,101 @@
+package evn
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+)
+
+type memDelayStore struct {
+	sync.Mutex
+	recs map[string]*DelayRecord
+}
+
+func (s *memDelayStore) Add(rec *DelayRecord) error {
+	s.Lock()
+	defer s.Unlock()
+	s.recs[rec.Id] = rec
+	return nil
+}
+func (s *memDelayStore) Remove(id string) error {
+	_, err := s.Claim(id)
+	return err
+}
+func (s *memDelayStore) Claim(id string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.recs[id]
+	delete(s.recs, id)
+	return ok, nil
+}
+func (s *memDelayStore) Load() ([]*DelayRecord, error) { return nil, nil }
+
+// 启动延迟队列, 返回已投递的Id列表
+func testDelayer(t *testing.T, store IDelayStore) (*delayer, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	fired := []string{}
+	d := newDelayer()
+	d.reset(store, func(d *Delay) { mu.Lock(); defer mu.Unlock(); fired = append(fired, d.id) }, t.Errorf)
+	d.start(t.Name())
+	t.Cleanup(func() { d.stop(context.Background()) })
+	return d, func() []string { mu.Lock(); defer mu.Unlock(); return append([]string{}, fired...) }
+}
+
+func TestDelayerOrderAndCancel(t *testing.T) {
+	d, fired := testDelayer(t, nil)
+	now, list := time.Now(), []*Delay{}
+	for i, ms := range []int{30, 10, 20, 40} {
+		list = append(list, &Delay{id: string(rune('a' + i)), at: now.Add(time.Duration(ms) * time.Millisecond), event: testEvent{}, index: -1})
+		d.add(list[i])
+	}
+	if d.len() != 4 {
+		t.Fatalf("expect 4 pending, got %d", d.len())
+	}
+	if last := list[3]; !last.Cancel() || last.Pending() || last.Cancel() {
+		t.Fatal("cancel pending delay failed")
+	}
+	waitUntil(t, func() bool { return len(fired()) == 3 })
+	if got := fired(); got[0] != "b" || got[1] != "c" || got[2] != "a" {
+		t.Fatalf("unexpected fire order %v", got)
+	}
+}
+
+// 存储已被其他实例认领的不投递
+func TestDelayerClaim(t *testing.T) {
+	store := &memDelayStore{recs: map[string]*DelayRecord{"won": {Id: "won"}}}
+	d, fired := testDelayer(t, store)
+	for _, id := range []string{"won", "lost"} {
+		d.add(&Delay{id: id, at: time.Now(), event: testEvent{}, stored: true, index: -1})
+	}
+	waitUntil(t, func() bool { return d.len() == 0 })
+	time.Sleep(20 * time.Millisecond)
+	if got := fired(); len(got) != 1 || got[0] != "won" {
+		t.Fatalf("expect only claimed delay fired, got %v", got)
+	}
+}
+
+// 初始化前延迟投递不panic, 启动后到期投递
+func TestPostAtBeforeInit(t *testing.T) {
+	app := ctl.NewApp("delay", "")
+	c := app.Install(Controller(&Config{Size: 1})).(*controller)
+	got := make(chan int, 1)
+	SubscribeTo(c, func(e testEvent) { got <- e.n })
+	c.PostAfter(10*time.Millisecond, testEvent{n: 5})
+
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+	select {
+	case n := <-got:
+		if n != 5 {
+			t.Fatalf("fired n=%d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delay posted before init not fired")
+	}
+}
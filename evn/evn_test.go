@@ -0,0 +1,42 @@
+package evn
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(&log.Config{Level: log.ELL_Warns})
+	code := m.Run()
+	log.Term()
+	os.Exit(code)
+}
+
+type testEvent struct{ n int }
+
+func (testEvent) EventId() TEventID { return "test.event" }
+
+// 包级预注册只属于默认应用
+func TestAppIsolation(t *testing.T) {
+	Register("test.iso", func(IEvent) {})
+	sub := Subscribe(func(testEvent) {})
+	defer sub.Cancel()
+	defer delete(units, "test.iso")
+
+	app := ctl.NewApp("iso", "")
+	c := app.Install(Controller(&Config{Size: 1})).(*controller)
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	if _, ok := c.handles["test.iso"]; ok {
+		t.Fatal("global Register leaked into non-default app")
+	}
+	if len(c.bus.types()) != 0 {
+		t.Fatalf("global Subscribe leaked into non-default app: %v", c.bus.types())
+	}
+}
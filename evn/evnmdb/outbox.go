@@ -0,0 +1,80 @@
+package evnmdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/evn"
+	"github.com/cloudapex/ulib/mdb"
+	"github.com/cloudapex/ulib/util"
+)
+
+// EventOutbox 事件外发箱(表ulib_evn_outbox, 不存在时自动创建; name默认为AppName, 各副本共用, 重放前原子认领)
+//
+//	支持事务写入: evn.PostTx(tx, event), tx为*mdb.Session, 提交后投递
+func EventOutbox(dbName string, name ...string) (evn.ITxOutbox, error) {
+	if err := mdb.CreateTable(&EventRecord{dbName: dbName}); err != nil {
+		return nil, err
+	}
+	return &eventOutbox{dbName, util.Tern(util.DefaultVal(name) == "", ctl.AppName(), util.DefaultVal(name))}, nil
+}
+
+// > 事件外发箱表
+type EventRecord struct {
+	Id      int64     `xorm:"pk autoincr"`
+	Owner   string    `xorm:"varchar(64) notnull index"`
+	EventId string    `xorm:"varchar(64) notnull unique"`
+	Type    string    `xorm:"varchar(191) notnull"`
+	Data    []byte    `xorm:"mediumblob"`
+	Orderly bool      `xorm:"notnull default false"`
+	At      int64     `xorm:"notnull default 0"`
+	Created time.Time `xorm:"created"`
+
+	dbName string `xorm:"-"`
+}
+
+func (t *EventRecord) DBName(e mdb.EDB) string { return t.dbName }
+func (t *EventRecord) TableName() string       { return "ulib_evn_outbox" }
+
+type eventOutbox struct {
+	dbName string
+	name   string
+}
+
+func (o *eventOutbox) HandleDepends() []string { return []string{"mdb"} }
+
+func (o *eventOutbox) Push(rec *evn.OutboxRecord) error { return o.PushTx(mdb.TxNil, rec) }
+
+func (o *eventOutbox) PushTx(tx evn.ITx, rec *evn.OutboxRecord) error {
+	sessn, ok := tx.(*mdb.Session)
+	if !ok {
+		return fmt.Errorf("evnmdb.EventOutbox tx must be *mdb.Session but got %T", tx)
+	}
+	row := &EventRecord{dbName: o.dbName, Owner: o.name, EventId: rec.Id, Type: rec.Type, Data: rec.Data, Orderly: rec.Orderly, At: rec.At}
+	_, err := mdb.TTable(sessn, row).Create()
+	return err
+}
+
+func (o *eventOutbox) Ack(id string) error {
+	_, err := mdb.MTable(&EventRecord{dbName: o.dbName, Owner: o.name, EventId: id}).Delete()
+	return err
+}
+
+// 按旧记录Id更新为新Id与写入时间, 更新成功即认领成功
+func (o *eventOutbox) Claim(id string, rec *evn.OutboxRecord) (bool, error) {
+	n, err := mdb.MTable(&EventRecord{dbName: o.dbName, Owner: o.name, EventId: id}).Update(&EventRecord{dbName: o.dbName, EventId: rec.Id, At: rec.At})
+	return n == 1, err
+}
+
+func (o *eventOutbox) Pending() ([]*evn.OutboxRecord, error) {
+	rows := []*EventRecord{}
+	if err := mdb.MTable(&EventRecord{dbName: o.dbName, Owner: o.name}).Find(&rows, mdb.COOrder(mdb.ESort_Asc, "id")); err != nil {
+		return nil, err
+	}
+	recs := make([]*evn.OutboxRecord, 0, len(rows))
+	for _, it := range rows {
+		recs = append(recs, &evn.OutboxRecord{Id: it.EventId, Type: it.Type, Data: it.Data, Orderly: it.Orderly, At: it.At})
+	}
+	return recs, nil
+}
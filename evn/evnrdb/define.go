@@ -0,0 +1,11 @@
+// Package evnrdb 基于rdb(redis)的evn存储与传输: 外发箱, 延迟事件存储, Redis Streams跨进程传输
+package evnrdb
+
+import "time"
+
+const (
+	C_STREAM_KEY      = "ulib:evn:stream" // evn跨进程传输默认流名称
+	C_STREAM_COUNT    = 32                // 每次读取的消息数量
+	C_STREAM_BLOCK    = 1 * time.Second   // 读取阻塞时间(也是停止接收的最长等待)
+	C_STREAM_MIN_IDLE = 1 * time.Minute   // 未确认消息被认领的空闲时间
+)
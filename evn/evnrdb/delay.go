@@ -0,0 +1,113 @@
+package evnrdb
+
+import (
+	"fmt"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/evn"
+	"github.com/cloudapex/ulib/rdb"
+	"github.com/cloudapex/ulib/util"
+)
+
+// DelayStore evn延迟事件存储(Zset: ulib:evn:{name}:delay 按投递时间排序, Hash: ulib:evn:{name}:delay:data 存放记录)
+//
+//	name默认为AppName, 各副本共用(重启或替换后的实例可恢复); 到期记录被原子认领, 只投递一次
+func DelayStore(dbName string, name ...string) evn.IDelayStore {
+	return &delayStore{dbName, util.Tern(util.DefaultVal(name) == "", ctl.AppName(), util.DefaultVal(name))}
+}
+
+type delayStore struct {
+	dbName string
+	name   string
+}
+
+func (s *delayStore) HandleDepends() []string { return []string{"rdb"} }
+
+func (s *delayStore) Add(rec *evn.DelayRecord) error {
+	data, zset := s.data(), s.zset()
+	return rdb.Exec(
+		rdb.Sender(data, func() { data.Set(rec.Id, rec) }),
+		rdb.Sender(zset, func() { zset.Add(rdb.ESet_Update, rec.Id, rec.FireAt) }),
+	).Error()
+}
+
+func (s *delayStore) Remove(id string) error {
+	_, err := s.take(id)
+	return err
+}
+
+func (s *delayStore) Claim(id string) (bool, error) { return s.take(id) }
+
+// 按投递时间顺序(缺少数据的记录与无排序的数据被清理)
+func (s *delayStore) Load() ([]*evn.DelayRecord, error) {
+	fields, err := s.data().Fields().Strings() // 先于排序集合读取: 其后写入的记录不会被误清理
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.zset().Range(0, -1).Strings()
+	if err != nil {
+		return nil, err
+	}
+	s.clean(fields, ids)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	vals, err := s.data().Getm(args...).Strings()
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make([]*evn.DelayRecord, 0, len(ids))
+	for i, v := range vals {
+		if v == "" {
+			s.zset().Del(ids[i])
+			continue
+		}
+		rec := &evn.DelayRecord{}
+		if err := rdb.Decode(rdb.ECod_Json, []byte(v), rec); err != nil {
+			return nil, fmt.Errorf("decode record %q err:%v", ids[i], err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// 原子移除记录, 返回是否由本次移除
+func (s *delayStore) take(id string) (bool, error) {
+	data, zset := s.data(), s.zset()
+	vals, err := rdb.Exec(
+		rdb.Sender(zset, func() { zset.Del(id) }),
+		rdb.Sender(data, func() { data.Del(id) }),
+	).Int64s()
+	if err != nil {
+		return false, err
+	}
+	return len(vals) > 0 && vals[0] == 1, nil
+}
+
+// 清理不在排序集合中的数据(ids为排序集合的全部成员)
+func (s *delayStore) clean(fields, ids []string) {
+	has := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		has[id] = true
+	}
+	orphans := []interface{}{}
+	for _, f := range fields {
+		util.Cast(!has[f], func() { orphans = append(orphans, f) }, nil)
+	}
+	if len(orphans) > 0 {
+		s.data().Del(orphans...)
+	}
+}
+
+// 两个键使用相同的hash tag, 集群下可在同一事务中操作
+func (s *delayStore) zset() *rdb.Zset {
+	return &rdb.Zset{Key: rdb.Key{DB: s.dbName, K: fmt.Sprintf("ulib:evn:{%s}:delay", s.name)}}
+}
+func (s *delayStore) data() *rdb.Hash {
+	return &rdb.Hash{Key: rdb.Key{DB: s.dbName, K: fmt.Sprintf("ulib:evn:{%s}:delay:data", s.name), Coding: rdb.ECod_Json}}
+}
@@ -0,0 +1,57 @@
+package evnrdb
+
+import (
+	"fmt"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/evn"
+	"github.com/cloudapex/ulib/rdb"
+	"github.com/cloudapex/ulib/util"
+)
+
+// EventOutbox 事件外发箱(Hash: ulib:evn:{name}:outbox, field为记录Id; name默认为AppName, 各副本共用, 重放前原子认领)
+func EventOutbox(dbName string, name ...string) evn.IOutbox {
+	return &eventOutbox{dbName, util.Tern(util.DefaultVal(name) == "", ctl.AppName(), util.DefaultVal(name))}
+}
+
+// 旧记录存在时才以新记录替换
+const outboxClaimScript = `if redis.call('HDEL', KEYS[1], ARGV[1]) == 1 then redis.call('HSET', KEYS[1], ARGV[2], ARGV[3]) return 1 end return 0`
+
+type eventOutbox struct {
+	dbName string
+	name   string
+}
+
+func (o *eventOutbox) HandleDepends() []string { return []string{"rdb"} }
+
+func (o *eventOutbox) Push(rec *evn.OutboxRecord) error { return o.hash().Set(rec.Id, rec).Error() }
+func (o *eventOutbox) Ack(id string) error              { return o.hash().Del(id).Error() }
+
+func (o *eventOutbox) Claim(id string, rec *evn.OutboxRecord) (bool, error) {
+	data, err := rdb.Encode(rdb.ECod_Json, rec)
+	if err != nil {
+		return false, err
+	}
+	n, err := rdb.Command(o.dbName, rdb.ECod_None, "EVAL", outboxClaimScript, 1, o.hash().K, id, rec.Id, data).Int()
+	return n == 1, err
+}
+
+func (o *eventOutbox) Pending() ([]*evn.OutboxRecord, error) {
+	mp, err := o.hash().GetAll().StringMap()
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]*evn.OutboxRecord, 0, len(mp))
+	for id, v := range mp {
+		rec := &evn.OutboxRecord{}
+		if err := rdb.Decode(rdb.ECod_Json, []byte(v), rec); err != nil {
+			return nil, fmt.Errorf("decode record %q err:%v", id, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func (o *eventOutbox) hash() *rdb.Hash {
+	return &rdb.Hash{Key: rdb.Key{DB: o.dbName, K: fmt.Sprintf("ulib:evn:%s:outbox", o.name), Coding: rdb.ECod_Json}}
+}
@@ -0,0 +1,263 @@
+package evnrdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/evn"
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/rdb"
+	"github.com/cloudapex/ulib/util"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// > Redis Streams事件传输配置
+type StreamConf struct {
+	DB       string        // rdb名称
+	Stream   string        // 流名称(默认C_STREAM_KEY)
+	Group    string        // 消费组(默认AppName, 同组内每条消息只被一个消费者处理, 不同组各自收到)
+	Consumer string        // 消费者名(默认hostname-pid)
+	Coding   rdb.ECoding   // 事件编码(默认ECod_Json)
+	MaxLen   int64         // 流最大长度(近似裁剪, 0:不裁剪)
+	Count    int           // 每次读取数量(默认C_STREAM_COUNT)
+	Block    time.Duration // 读取阻塞时间(默认C_STREAM_BLOCK)
+	MinIdle  time.Duration // 未确认超过此时间的消息被认领重投(默认C_STREAM_MIN_IDLE)
+} //
+func (c *StreamConf) revise() {
+	c.Stream = util.Tern(c.Stream == "", C_STREAM_KEY, c.Stream)
+	c.Group = util.Tern(c.Group == "", ctl.AppName(), c.Group)
+	if c.Consumer == "" {
+		host, _ := os.Hostname()
+		c.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	c.Coding = util.Tern(c.Coding == rdb.ECod_None, rdb.ECod_Json, c.Coding)
+	c.Count = util.Tern(c.Count <= 0, C_STREAM_COUNT, c.Count)
+	c.Block = util.Tern(c.Block <= 0, C_STREAM_BLOCK, c.Block)
+	c.MinIdle = util.Tern(c.MinIdle <= 0, C_STREAM_MIN_IDLE, c.MinIdle)
+}
+
+// StreamTransport 基于Redis Streams的evn跨进程传输(需redis>=6.2, 事件控制器初始化时检查; 事件类型需evn.RegisterType注册)
+//
+//	消息字段: type(注册的类型名) id(EventId) data(按Coding编码的事件)
+func StreamTransport(conf *StreamConf) evn.ITransport {
+	c := *conf
+	c.revise()
+	return &streamTransport{&c}
+}
+
+type streamTransport struct {
+	conf *StreamConf
+}
+
+func (t *streamTransport) HandleDepends() []string { return []string{"rdb"} }
+
+// 检查redis版本(XPENDING IDLE等需redis>=6.2)
+func (t *streamTransport) Prepare() error {
+	info, err := rdb.Command(t.conf.DB, rdb.ECod_None, "INFO", "server").String()
+	if err != nil {
+		return fmt.Errorf("evnrdb.StreamTransport check redis version err:%v", err)
+	}
+	major, minor := redisVersion(info)
+	if major < 6 || major == 6 && minor < 2 {
+		return fmt.Errorf("evnrdb.StreamTransport requires redis>=6.2, got %d.%d", major, minor)
+	}
+	return nil
+}
+
+func (t *streamTransport) Send(event evn.IEvent) error {
+	name, ok := evn.TypeName(event)
+	if !ok {
+		return fmt.Errorf("event type %T not registered", event)
+	}
+	data, err := rdb.Encode(t.conf.Coding, event)
+	if err != nil {
+		return err
+	}
+
+	args := redis.Args{}.Add(t.conf.Stream)
+	if t.conf.MaxLen > 0 {
+		args = args.Add("MAXLEN", "~", t.conf.MaxLen)
+	}
+	args = args.Add("*", "type", name, "id", event.EventId(), "data", data)
+	return rdb.Command(t.conf.DB, rdb.ECod_None, "XADD", args...).Error()
+}
+
+// 先处理本消费者未确认的, 再读取新消息; 每MinIdle认领一次其他消费者超时未确认的
+func (t *streamTransport) Recv(ctx context.Context, deliver func(event evn.IEvent, ack func())) error {
+	conn := rdb.Connector(t.conf.DB)
+	if conn == nil {
+		return fmt.Errorf("rdb.pool[%q] not found", t.conf.DB)
+	}
+	defer conn.Close()
+
+	if err := t.createGroup(conn); err != nil {
+		return err
+	}
+
+	lastId, claimAt := "0", time.Time{} // 启动时先认领一次
+	for ctx.Err() == nil {
+		if time.Since(claimAt) >= t.conf.MinIdle {
+			if err := t.claim(conn, deliver); err != nil {
+				return err
+			}
+			claimAt = time.Now()
+		}
+
+		args := redis.Args{}.Add("GROUP", t.conf.Group, t.conf.Consumer, "COUNT", t.conf.Count)
+		if lastId == ">" {
+			args = args.Add("BLOCK", t.conf.Block.Milliseconds())
+		}
+		r, err := conn.Do("XREADGROUP", args.Add("STREAMS", t.conf.Stream, lastId)...)
+		if err != nil && err != redis.ErrNil {
+			return fmt.Errorf("xreadgroup err:%v", err)
+		}
+		entries, err := streamEntries(r)
+		if err != nil {
+			return err
+		}
+		if lastId != ">" {
+			if len(entries) == 0 {
+				lastId = ">" // 未确认的已处理完
+				continue
+			}
+			lastId = entries[len(entries)-1].id
+		}
+		t.handle(entries, deliver)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------
+type streamEntry struct {
+	id     string
+	fields map[string]string
+}
+
+func (t *streamTransport) createGroup(conn redis.Conn) error {
+	_, err := conn.Do("XGROUP", "CREATE", t.conf.Stream, t.conf.Group, "$", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("xgroup create err:%v", err)
+	}
+	return nil
+}
+
+// 认领其他消费者超时未确认的消息(本消费者的可能仍在进程内排队或处理, 不认领)
+func (t *streamTransport) claim(conn redis.Conn, deliver func(event evn.IEvent, ack func())) error {
+	idle := t.conf.MinIdle.Milliseconds()
+	for start := "-"; ; {
+		r, err := redis.Values(conn.Do("XPENDING", t.conf.Stream, t.conf.Group, "IDLE", idle, start, "+", t.conf.Count))
+		if err != nil {
+			return fmt.Errorf("xpending err:%v", err)
+		}
+		ids := []interface{}{}
+		for _, it := range r {
+			p, err := redis.Values(it, nil)
+			if err != nil || len(p) < 2 {
+				return fmt.Errorf("invalid xpending reply %v", it)
+			}
+			id, _ := redis.String(p[0], nil)
+			owner, _ := redis.String(p[1], nil)
+			util.Cast(owner != t.conf.Consumer, func() { ids = append(ids, id) }, nil)
+			start = "(" + id
+		}
+		if len(ids) > 0 {
+			args := redis.Args{}.Add(t.conf.Stream, t.conf.Group, t.conf.Consumer, idle).Add(ids...)
+			r, err := conn.Do("XCLAIM", args...)
+			if err != nil {
+				return fmt.Errorf("xclaim err:%v", err)
+			}
+			entries, err := parseEntries(r)
+			if err != nil {
+				return err
+			}
+			t.handle(entries, deliver)
+		}
+		if len(r) < t.conf.Count {
+			return nil
+		}
+	}
+}
+
+// 解码并投递(未注册或无法解码的消息直接确认, 避免反复重投)
+func (t *streamTransport) handle(entries []*streamEntry, deliver func(event evn.IEvent, ack func())) {
+	for _, e := range entries {
+		id := e.id
+		ack := func() { t.ack(id) }
+
+		data := e.fields["data"]
+		event, err := evn.UnmarshalWith(e.fields["type"], func(v interface{}) error { return rdb.Decode(t.conf.Coding, []byte(data), v) })
+		if err != nil {
+			log.Debug("evnrdb.StreamTransport[%s] skip %q err:%v", t.conf.Stream, id, err)
+			ack()
+			continue
+		}
+		deliver(event, ack)
+	}
+}
+func (t *streamTransport) ack(id string) {
+	if err := rdb.Command(t.conf.DB, rdb.ECod_None, "XACK", t.conf.Stream, t.conf.Group, id).Error(); err != nil {
+		log.Error("evnrdb.StreamTransport[%s] ack %q err:%v", t.conf.Stream, id, err)
+	}
+}
+
+// XREADGROUP: [[stream, [[id, [k, v, ...]], ...]]]
+func streamEntries(r interface{}) ([]*streamEntry, error) {
+	if r == nil {
+		return nil, nil
+	}
+	streams, err := redis.Values(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*streamEntry{}
+	for _, s := range streams {
+		kv, err := redis.Values(s, nil)
+		if err != nil || len(kv) != 2 {
+			return nil, fmt.Errorf("invalid stream reply %v", s)
+		}
+		list, err := parseEntries(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, list...)
+	}
+	return entries, nil
+}
+
+// 解析INFO中的redis_version(主版本, 次版本)
+func redisVersion(info string) (major, minor int) {
+	for _, line := range strings.Split(info, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+			fmt.Sscanf(v, "%d.%d", &major, &minor)
+			break
+		}
+	}
+	return
+}
+
+// [[id, [k, v, ...]], ...] (已删除的消息字段为nil)
+func parseEntries(r interface{}) ([]*streamEntry, error) {
+	items, err := redis.Values(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*streamEntry, 0, len(items))
+	for _, it := range items {
+		if it == nil { // XCLAIM时已被删除的消息(redis<7)
+			continue
+		}
+		pair, err := redis.Values(it, nil)
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("invalid stream entry %v", it)
+		}
+		id, _ := redis.String(pair[0], nil)
+		fields, _ := redis.StringMap(pair[1], nil)
+		entries = append(entries, &streamEntry{id, util.Tern(fields == nil, map[string]string{}, fields)})
+	}
+	return entries, nil
+}
@@ -0,0 +1,141 @@
+package evnrdb
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/evn"
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/rdb"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(&log.Config{Level: log.ELL_Warns})
+	code := m.Run()
+	log.Term()
+	os.Exit(code)
+}
+
+type streamEvent struct{ N int }
+
+func (streamEvent) EventId() evn.TEventID { return "test.stream" }
+
+func TestRedisVersion(t *testing.T) {
+	for info, want := range map[string][2]int{
+		"# Server\r\nredis_version:7.0.11\r\nredis_mode:standalone\r\n": {7, 0},
+		"redis_version:6.2.0\r\n":   {6, 2},
+		"redis_version:5.0.14\r\n":  {5, 0},
+		"redis_mode:standalone\r\n": {0, 0},
+	} {
+		if major, minor := redisVersion(info); major != want[0] || minor != want[1] {
+			t.Errorf("redisVersion(%q) = %d.%d, want %d.%d", info, major, minor, want[0], want[1])
+		}
+	}
+}
+
+// 启动临时redis-server(不存在则跳过)
+func startRedis(t *testing.T) string {
+	t.Helper()
+	bin, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not found")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cmd := exec.Command(bin, "--port", fmt.Sprint(port), "--bind", "127.0.0.1", "--save", "", "--appendonly", "no")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if conn, err := redis.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+	}
+	t.Fatal("redis-server not ready")
+	return ""
+}
+
+func TestStreamTransport(t *testing.T) {
+	addr := startRedis(t)
+
+	evn.RegisterType[streamEvent]("test.stream")
+	tr := StreamTransport(&StreamConf{DB: "test", Stream: "test:stream", Group: "test"})
+	rdb.Install([]*rdb.Config{{Name: "test", Addr: addr, MaxIdle: 2, MaxActive: 8}})
+	evn.Install(&evn.Config{Size: 1, Transport: tr})
+	if err := ctl.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.Stop()
+
+	t.Run("roundtrip", func(t *testing.T) {
+		got := make(chan int, 1)
+		sub := evn.Subscribe(func(e streamEvent) { got <- e.N })
+		defer sub.Cancel()
+
+		if err := evn.Broadcast(streamEvent{7}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case n := <-got:
+			if n != 7 {
+				t.Fatalf("received n=%d", n)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("broadcast event not received")
+		}
+	})
+
+	// 本消费者未确认的消息不被自己认领, 其他消费者可认领
+	t.Run("claim", func(t *testing.T) {
+		conf := StreamConf{DB: "test", Stream: "test:claim", Group: "test", Consumer: "a", MinIdle: 10 * time.Millisecond}
+		a := StreamTransport(&conf).(*streamTransport)
+		conf.Consumer = "b"
+		b := StreamTransport(&conf).(*streamTransport)
+
+		conn := rdb.Connector("test")
+		defer conn.Close()
+		if err := a.createGroup(conn); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Send(streamEvent{1}); err != nil {
+			t.Fatal(err)
+		}
+		r, err := conn.Do("XREADGROUP", "GROUP", conf.Group, "a", "COUNT", 1, "STREAMS", conf.Stream, ">")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := streamEntries(r); len(entries) != 1 {
+			t.Fatalf("read %d entries", len(entries))
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		count := func(tr *streamTransport) (n int) {
+			if err := tr.claim(conn, func(evn.IEvent, func()) { n++ }); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		if n := count(a); n != 0 {
+			t.Fatalf("consumer claimed its own pending %d", n)
+		}
+		if n := count(b); n != 1 {
+			t.Fatalf("other consumer claimed %d, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package evn
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+const (
+	futureQueued int32 = iota
+	futureRunning
+	futureDone
+	futureCanceled
+)
+
+// > 异步任务结果
+type Future struct {
+	state  atomic.Int32
+	done   chan struct{}
+	result interface{}
+	err    error
+	task   *Task // 所属任务(取消时从积压中扣除)
+}
+
+func newFuture() *Future { return &Future{done: make(chan struct{})} }
+
+// 完成通知
+func (f *Future) Done() <-chan struct{} { return f.done }
+
+// 等待结果(ctx到期返回ctx.Err(), 任务不受影响, 需要时调用Cancel)
+func (f *Future) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 取消尚未开始执行的任务(不再计入积压, 队列满时被清除), 返回是否取消成功
+func (f *Future) Cancel() bool {
+	if !f.state.CompareAndSwap(futureQueued, futureCanceled) {
+		return false
+	}
+	util.Cast(f.task != nil, func() { f.task.canceled.Add(1) }, nil)
+	f.result, f.err = nil, ErrTaskCanceled
+	close(f.done)
+	return true
+}
+
+// 是否已取消
+func (f *Future) Canceled() bool { return f.state.Load() == futureCanceled }
+
+// ------------------------------------------------------------------------------
+func (f *Future) start() bool { return f.state.CompareAndSwap(futureQueued, futureRunning) }
+
+func (f *Future) complete(result interface{}, err error) {
+	if f.state.Swap(futureDone) == futureCanceled {
+		f.state.Store(futureCanceled)
+		return
+	}
+	f.result, f.err = result, err
+	close(f.done)
+}
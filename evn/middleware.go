@@ -0,0 +1,152 @@
+package evn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+// > 事件处理上下文(中间件链中传递)
+type Context struct {
+	context.Context        // 控制器停止时取消
+	Event           IEvent //
+	Handler         string // 处理器名称(订阅名, Listen为事件Id, PostDo为"do")
+	Attempt         int    // 重试次数(0:首次)
+
+	app    string
+	logger log.ILoger
+	chain  []TMiddleware
+	index  int
+	final  TEventHandlerE
+}
+
+// 执行后续中间件及处理器(可重复调用, 用于重试)
+func (c *Context) Next() error {
+	i := c.index
+	defer func() { c.index = i }()
+
+	c.index++
+	if c.index < len(c.chain) {
+		return c.chain[c.index](c)
+	}
+	return c.final(c.Event)
+}
+
+// 日志(事件Id, 处理器, 耗时; 失败时为警告)
+func Logging() TMiddleware {
+	return func(c *Context) error {
+		start := time.Now()
+		err := c.Next()
+		if err != nil {
+			c.logger.Warn("event:%q handler:%s attempt:%d cost:%v err:%v", c.Event.EventId(), c.Handler, c.Attempt, time.Since(start), err)
+		} else {
+			c.logger.Debug("event:%q handler:%s cost:%v", c.Event.EventId(), c.Handler, time.Since(start))
+		}
+		return err
+	}
+}
+
+// panic转为错误(以便被重试或转入死信)
+func Recovery() TMiddleware {
+	return func(c *Context) (err error) {
+		defer func() {
+			if x := recover(); x != nil {
+				util.Catch(fmt.Sprintf("Handler[%s] handle event(%s) panic", c.Handler, c.Event.EventId()), x)
+				err = fmt.Errorf("panic: %v", x)
+			}
+		}()
+		return c.Next()
+	}
+}
+
+// 失败重试(最多times次, 间隔backoff<<attempt, 不超过C_RETRY_MAX_BACKOFF; 重试期间占用当前任务)
+func Retry(times int, backoff time.Duration) TMiddleware {
+	return func(c *Context) error {
+		err := c.Next()
+		for ; err != nil && c.Attempt < times; err = c.Next() {
+			select {
+			case <-time.After(util.Backoff(backoff, c.Attempt, C_RETRY_MAX_BACKOFF)):
+			case <-c.Done():
+				return err
+			}
+			c.Attempt++
+		}
+		return err
+	}
+}
+
+// 失败的事件转入死信(之后视为已处理)
+func DeadLetterTo(sink IDeadLetterSink) TMiddleware {
+	return func(c *Context) error {
+		err := c.Next()
+		if err == nil {
+			return nil
+		}
+		sink.Put(&DeadLetter{Event: c.Event, Handler: c.Handler, Attempt: c.Attempt, Error: err.Error(), At: time.Now()})
+		return nil
+	}
+}
+
+// 统计处理次数(evn_handled_total; 耗时由控制器记录在evn_handle_seconds)
+func Metrics() TMiddleware {
+	handled := ctl.Metrics("evn").NewCounter("handled_total", "Handler invocations by event id, handler and result.", "app", "event", "handler", "result")
+	return func(c *Context) error {
+		err := c.Next()
+		handled.With(c.app, c.Event.EventId(), c.Handler, util.Tern(err == nil, "ok", "error")).Inc()
+		return err
+	}
+}
+
+// 链路追踪(start在处理前调用, 可替换c.Context以传递span, 返回的end在处理后调用)
+func Tracing(start func(c *Context) (end func(err error))) TMiddleware {
+	return func(c *Context) error {
+		end := start(c)
+		err := c.Next()
+		util.Cast(end != nil, func() { end(err) }, nil)
+		return err
+	}
+}
+
+// ==================== DeadLetters
+
+// > 内存死信(保留最近size条, 可用于内省)
+type DeadLetters struct {
+	util.RWLocker
+	items []*DeadLetter
+	next  int
+	total int
+}
+
+func NewDeadLetters(size ...int) *DeadLetters {
+	return &DeadLetters{items: make([]*DeadLetter, util.Tern(util.DefaultVal(size) > 0, util.DefaultVal(size), C_DEAD_LETTER_SIZE))}
+}
+
+func (d *DeadLetters) Put(dl *DeadLetter) {
+	defer d.UnLock(d.Lock())
+	d.items[d.next] = dl
+	d.next, d.total = (d.next+1)%len(d.items), d.total+1
+}
+
+// 保留的死信(按时间倒序)
+func (d *DeadLetters) List() []*DeadLetter {
+	defer d.RUnLock(d.RLock())
+	list := make([]*DeadLetter, 0, min(d.total, len(d.items)))
+	for i := 1; i <= len(d.items); i++ {
+		it := d.items[(d.next-i+len(d.items))%len(d.items)]
+		if it == nil {
+			break
+		}
+		list = append(list, it)
+	}
+	return list
+}
+
+// 累计数量
+func (d *DeadLetters) Total() int {
+	defer d.RUnLock(d.RLock())
+	return d.total
+}
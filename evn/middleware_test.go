@@ -0,0 +1,35 @@
+package evn
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+)
+
+// 安装前的Use/UseFor作为默认应用的预注册
+func TestUseBeforeInstall(t *testing.T) {
+	var global, scoped atomic.Int32
+	Use(func(c *Context) error { global.Add(1); return c.Next() })
+	UseFor("test.event", func(c *Context) error { scoped.Add(1); return c.Next() })
+
+	Install(&Config{Size: 1})
+	if err := ctl.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { ctl.Stop(); Ctl, uses, usesFor = nil, nil, map[TEventID][]TMiddleware{} }()
+
+	done := make(chan struct{}, 1)
+	sub := Subscribe(func(testEvent) { done <- struct{}{} })
+	defer sub.Cancel()
+	Post(testEvent{})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("event not handled")
+	}
+	if global.Load() != 1 || scoped.Load() != 1 {
+		t.Fatalf("pre-installed middlewares not applied, global:%d scoped:%d", global.Load(), scoped.Load())
+	}
+}
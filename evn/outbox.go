@@ -0,0 +1,155 @@
+package evn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+var (
+	outboxSeq  atomic.Uint32
+	outboxInst = fmt.Sprintf("%08x", rand.Uint32()) // 进程标识(多副本共用外发箱时避免Id冲突)
+)
+
+// 时间有序的记录Id
+func outboxId() string {
+	return fmt.Sprintf("%016x-%s-%06x", time.Now().UnixNano(), outboxInst, outboxSeq.Add(1)&0xffffff)
+}
+
+// 生成外发箱记录(未配置外发箱或非durable事件返回nil)
+func (this *controller) record(event IEvent, orderly bool) *OutboxRecord {
+	if this.Conf.Outbox == nil {
+		return nil
+	}
+	et := lookupType(reflect.TypeOf(event))
+	if et == nil || !et.durable {
+		return nil
+	}
+	name, data, err := Marshal(event)
+	if err != nil {
+		this.Error("outbox marshal event:%q err:%v", event.EventId(), err)
+		return nil
+	}
+	return &OutboxRecord{Id: outboxId(), Type: name, Data: data, Orderly: orderly, At: time.Now().UnixMilli()}
+}
+
+// 写入外发箱(失败时仅内存投递)
+func (this *controller) persist(event IEvent, orderly bool) string {
+	rec := this.record(event, orderly)
+	if rec == nil {
+		return ""
+	}
+	if err := this.Conf.Outbox.Push(rec); err != nil {
+		this.Error("outbox push event:%q err:%v", event.EventId(), err)
+		return ""
+	}
+	return rec.Id
+}
+
+// 投递到任务(id非空时处理成功后确认, 失败或被丢弃则保留在外发箱待重放)
+func (this *controller) post(event IEvent, orderly bool, id string) {
+	task, err := this.route(event, orderly)
+	if err != nil { // 已写入外发箱的保留待重放
+		this.Error("post event:%q err:%v", event.EventId(), err)
+		return
+	}
+	if id == "" {
+		task.Post(event)
+		return
+	}
+	task.Post(event, this.acker(event, id))
+}
+func (this *controller) acker(event IEvent, id string) func(interface{}, error) {
+	return func(_ interface{}, err error) {
+		if errors.Is(err, ErrNoHandler) { // 无处理者时重放也无法处理, 直接确认
+			this.Warn("outbox event:%q(%s) acked without handler", event.EventId(), id)
+			this.ack(id)
+			return
+		}
+		if err != nil {
+			this.Warn("outbox event:%q(%s) kept for replay err:%v", event.EventId(), id, err)
+			return
+		}
+		this.ack(id)
+	}
+}
+func (this *controller) ack(id string) {
+	if err := this.Conf.Outbox.Ack(id); err != nil {
+		this.Error("outbox ack %q err:%v", id, err)
+	}
+}
+
+// 重放未确认的记录(应用启动完成后执行, 此时处理器与订阅均已注册)
+//
+//	外发箱实现IOutboxClaimer时每C_OUTBOX_LEASE再检查一次(多实例共用时认领被替换实例遗留的记录)
+func (this *controller) replay(context.Context) error {
+	ctx := this.ctx
+	if this.Conf.Outbox == nil || ctx == nil || ctx.Err() != nil {
+		return nil
+	}
+	this.sweep()
+	if _, ok := this.Conf.Outbox.(IOutboxClaimer); !ok {
+		return nil
+	}
+	util.Goroutine(this.HandleName()+".replay", func() {
+		ticker := time.NewTicker(C_OUTBOX_LEASE)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				this.sweep()
+			}
+		}
+	})
+	return nil
+}
+
+// 重放启动前写入且超过租期未确认的记录(按Id即写入顺序; 启动后写入的由投递本身确认, 不重放)
+func (this *controller) sweep() {
+	recs, err := this.Conf.Outbox.Pending()
+	if err != nil {
+		this.Error("outbox load pending err:%v", err)
+		return
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Id < recs[j].Id })
+
+	claimer, _ := this.Conf.Outbox.(IOutboxClaimer)
+	before := this.startAt
+	if lease := time.Now().Add(-C_OUTBOX_LEASE); claimer != nil && lease.Before(before) {
+		before = lease // 共用时其他实例的记录可能仍在处理中
+	}
+
+	n := 0
+	for _, rec := range recs {
+		if rec.At >= before.UnixMilli() {
+			continue
+		}
+		event, err := Unmarshal(rec.Type, rec.Data)
+		if err != nil {
+			this.Error("outbox replay %q err:%v", rec.Id, err)
+			continue
+		}
+		id := rec.Id
+		if claimer != nil {
+			claimed := *rec
+			claimed.Id, claimed.At = outboxId(), time.Now().UnixMilli()
+			if ok, err := claimer.Claim(rec.Id, &claimed); err != nil || !ok {
+				util.Cast(err != nil, func() { this.Error("outbox claim %q err:%v", rec.Id, err) }, nil)
+				continue
+			}
+			id = claimed.Id
+		}
+		this.post(event, rec.Orderly, id)
+		n++
+	}
+	util.Cast(n > 0, func() { this.Info("outbox replay %d/%d events", n, len(recs)) }, nil)
+}
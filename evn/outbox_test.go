@@ -0,0 +1,149 @@
+package evn
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+)
+
+type memOutbox struct {
+	sync.Mutex
+	recs map[string]*OutboxRecord
+}
+
+func (o *memOutbox) Push(rec *OutboxRecord) error {
+	o.Lock()
+	defer o.Unlock()
+	o.recs[rec.Id] = rec
+	return nil
+}
+func (o *memOutbox) Ack(id string) error {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.recs, id)
+	return nil
+}
+func (o *memOutbox) Pending() ([]*OutboxRecord, error) {
+	o.Lock()
+	defer o.Unlock()
+	recs := []*OutboxRecord{}
+	for _, rec := range o.recs {
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+func (o *memOutbox) has(id string) bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.recs[id] != nil
+}
+
+type outboxHandled struct{ N int }
+
+func (outboxHandled) EventId() TEventID { return "test.outbox.handled" }
+
+type outboxOrphan struct{ N int }
+
+func (outboxOrphan) EventId() TEventID { return "test.outbox.orphan" }
+
+type outboxLive struct{ N int }
+
+func (outboxLive) EventId() TEventID { return "test.outbox.live" }
+
+// 测试用的可认领外发箱(lost中的记录视为已被其他实例认领)
+type claimOutbox struct {
+	*memOutbox
+	lost map[string]bool
+}
+
+func (o *claimOutbox) Claim(id string, rec *OutboxRecord) (bool, error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.recs[id] == nil || o.lost[id] {
+		return false, nil
+	}
+	delete(o.recs, id)
+	o.recs[rec.Id] = rec
+	return true, nil
+}
+
+// 写入测试记录(Id为事件Id)
+func pushRecord(t *testing.T, box IOutbox, e IEvent, at time.Time) {
+	t.Helper()
+	name, data, err := Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box.Push(&OutboxRecord{Id: string(e.EventId()), Type: name, Data: data, At: at.UnixMilli()})
+}
+
+// 启动完成后重放(启动钩子中注册的订阅也能收到), 无处理者的记录被确认, 启动后写入的不重放
+func TestOutboxReplayAfterStart(t *testing.T) {
+	Durable[outboxHandled]("test.outbox.handled")
+	Durable[outboxOrphan]("test.outbox.orphan")
+	Durable[outboxLive]("test.outbox.live")
+
+	box := &memOutbox{recs: map[string]*OutboxRecord{}}
+	pushRecord(t, box, outboxHandled{1}, time.Now().Add(-time.Minute))
+	pushRecord(t, box, outboxOrphan{2}, time.Now().Add(-time.Minute))
+	pushRecord(t, box, outboxLive{3}, time.Now().Add(time.Hour))
+
+	app := ctl.NewApp("outbox", "")
+	c := app.Install(Controller(&Config{Size: 1, Outbox: box})).(*controller)
+	got := make(chan int, 2)
+	app.OnStarted(func(context.Context) error {
+		SubscribeTo(c, func(e outboxHandled) { got <- e.N })
+		SubscribeTo(c, func(e outboxLive) { got <- e.N })
+		return nil
+	})
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	select {
+	case n := <-got:
+		if n != 1 {
+			t.Fatalf("replayed event n=%d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("outbox not replayed after start")
+	}
+	waitUntil(t, func() bool { return !box.has("test.outbox.handled") && !box.has("test.outbox.orphan") })
+	time.Sleep(50 * time.Millisecond)
+	if len(got) != 0 || !box.has("test.outbox.live") {
+		t.Fatal("record written after start was replayed")
+	}
+}
+
+// 可认领的外发箱只重放认领成功的记录
+func TestOutboxReplayClaim(t *testing.T) {
+	Durable[outboxHandled]("test.outbox.handled")
+	Durable[outboxOrphan]("test.outbox.orphan")
+
+	box := &claimOutbox{&memOutbox{recs: map[string]*OutboxRecord{}}, map[string]bool{"test.outbox.handled": true}}
+	pushRecord(t, box, outboxHandled{1}, time.Now().Add(-time.Hour))
+	pushRecord(t, box, outboxOrphan{2}, time.Now().Add(-time.Hour))
+
+	app := ctl.NewApp("outbox-claim", "")
+	c := app.Install(Controller(&Config{Size: 1, Outbox: box})).(*controller)
+	got := make(chan int, 1)
+	SubscribeTo(c, func(e outboxHandled) { got <- e.N })
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	waitUntil(t, func() bool { box.Lock(); defer box.Unlock(); return len(box.recs) == 1 })
+	select {
+	case n := <-got:
+		t.Fatalf("record claimed by another instance replayed n=%d", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !box.has("test.outbox.handled") {
+		t.Fatal("record claimed by another instance removed")
+	}
+}
@@ -1,6 +1,11 @@
 package evn
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
 	"github.com/cloudapex/ulib/ctl"
 
 	"github.com/cloudapex/ulib/util"
@@ -9,7 +14,10 @@ import (
 var (
 	Ctl IContrler // 默认事件系统控制器
 
-	units = map[TEventID]TEventHandler{}
+	units   = map[TEventID]TEventHandler{}
+	subs    = newBus()                     // 安装前的预订阅
+	uses    []TMiddleware                  // 安装前的全局中间件
+	usesFor = map[TEventID][]TMiddleware{} // 安装前的按事件Id中间件
 )
 
 // 安装控制器
@@ -19,7 +27,13 @@ func Install(conf *Config) ctl.IControler {
 	return c
 }
 
-// Register 预注册监听事件
+// 获取指定应用中安装的控制器(未安装则为nil)
+func Of(app *ctl.App) IContrler {
+	c, _ := app.Controler("evn").(IContrler)
+	return c
+}
+
+// Register 预注册监听事件(属于默认应用; 其他应用使用控制器的Listen)
 func Register(id TEventID, handle TEventHandler) {
 	units[id] = handle
 }
@@ -34,7 +48,138 @@ func Post(event IEvent, orderly ...bool) {
 	Ctl.Post(event, orderly...)
 }
 
+// 尝试投递事件(按Config.Overflow策略处理, 返回未能入队的原因)
+func TryPost(event IEvent, orderly ...bool) error {
+	return Ctl.TryPost(event, orderly...)
+}
+
+// 事务投递(durable事件在事务内写入外发箱, 提交后投递; 否则仅在提交后投递)
+func PostTx(tx ITx, event IEvent, orderly ...bool) error {
+	return Ctl.PostTx(tx, event, orderly...)
+}
+
+// 在指定时间投递(返回的句柄可取消; 配置Config.Delay且事件类型已注册时持久化)
+func PostAt(at time.Time, event IEvent, orderly ...bool) *Delay {
+	return Ctl.PostAt(at, event, orderly...)
+}
+
+// 在指定时间后投递(同上)
+func PostAfter(after time.Duration, event IEvent, orderly ...bool) *Delay {
+	return Ctl.PostAfter(after, event, orderly...)
+}
+
+// 广播事件到其他进程(经Config.Transport)
+func Broadcast(event IEvent) error {
+	return Ctl.Broadcast(event)
+}
+
 // 投递事件并自动监听(orderly:此事件是否需要被有序处理)
 func PostDo(event IEventDo, orderly ...bool) {
 	Ctl.PostDo(event, orderly...)
 }
+
+// Subscribe 按事件类型订阅(同一类型可多个订阅者, 安装前调用则作为默认应用的预订阅)
+func Subscribe[T IEvent](handle func(T), opt ...*SubOpt) *Subscription {
+	if Ctl == nil {
+		return subs.add(typeOf[T](), wrapHandleE(func(e T) error { handle(e); return nil }), nil, util.DefaultVal(opt))
+	}
+	return SubscribeTo(Ctl, handle, opt...)
+}
+
+// SubscribeE 按事件类型订阅(处理器返回错误, 可被中间件重试或转入死信)
+func SubscribeE[T IEvent](handle func(T) error, opt ...*SubOpt) *Subscription {
+	if Ctl == nil {
+		return subs.add(typeOf[T](), wrapHandleE(handle), nil, util.DefaultVal(opt))
+	}
+	return SubscribeToE(Ctl, handle, opt...)
+}
+
+// SubscribeToE 在指定控制器上按事件类型订阅(处理器返回错误)
+func SubscribeToE[T IEvent](c IContrler, handle func(T) error, opt ...*SubOpt) *Subscription {
+	return c.SubscribeE(typeOf[T](), wrapHandleE(handle), opt...)
+}
+
+// Use 添加全局中间件(按添加顺序由外到内, 如Logging(),Metrics(),DeadLetterTo(sink),Retry(3,time.Second),Recovery(); 安装前调用则作为默认应用的预注册)
+func Use(mws ...TMiddleware) {
+	if Ctl == nil {
+		uses = append(uses, mws...)
+		return
+	}
+	Ctl.Use(mws...)
+}
+
+// UseFor 添加指定事件Id的中间件(在全局中间件之后; 安装前调用则作为默认应用的预注册)
+func UseFor(id TEventID, mws ...TMiddleware) {
+	if Ctl == nil {
+		usesFor[id] = append(usesFor[id], mws...)
+		return
+	}
+	Ctl.UseFor(id, mws...)
+}
+
+// SubscribeTo 在指定控制器上按事件类型订阅
+func SubscribeTo[T IEvent](c IContrler, handle func(T), opt ...*SubOpt) *Subscription {
+	return c.Subscribe(typeOf[T](), wrapHandle(handle), opt...)
+}
+
+// Respond 按事件类型注册应答者(仅响应Call/CallAll, 安装前调用则作为预注册)
+func Respond[T IEvent, R any](handle func(T) (R, error), opt ...*SubOpt) *Subscription {
+	if Ctl == nil {
+		return subs.add(typeOf[T](), nil, wrapCall(handle), util.DefaultVal(opt))
+	}
+	return RespondTo(Ctl, handle, opt...)
+}
+
+// RespondTo 在指定控制器上注册应答者
+func RespondTo[T IEvent, R any](c IContrler, handle func(T) (R, error), opt ...*SubOpt) *Subscription {
+	return c.Respond(typeOf[T](), wrapCall(handle), opt...)
+}
+
+// Request 异步请求(由优先级最高的应答者处理, 未开始前可通过Future.Cancel取消)
+func Request(event IEvent, orderly ...bool) *Future {
+	return Ctl.Request(event, orderly...)
+}
+
+// Call 请求并等待结果(ctx到期时取消尚未开始的请求)
+//
+//	在事件处理器内调用时, 请求可能路由到当前所在的任务而等待自身直到ctx到期, 此时应使用Request异步处理结果
+func Call(ctx context.Context, event IEvent) (interface{}, error) {
+	return Ctl.Call(ctx, event)
+}
+
+// CallAs 请求并按类型返回结果
+func CallAs[R any](ctx context.Context, event IEvent) (R, error) {
+	var zero R
+	ret, err := Ctl.Call(ctx, event)
+	if err != nil {
+		return zero, err
+	}
+	r, ok := ret.(R)
+	if !ok && ret != nil {
+		return zero, fmt.Errorf("call result %T is not %T", ret, zero)
+	}
+	return r, nil
+}
+
+// CallAll 请求所有应答者并收集结果(按优先级顺序)
+func CallAll(ctx context.Context, event IEvent) ([]*CallResult, error) {
+	return Ctl.CallAll(ctx, event)
+}
+
+// Publish 投递类型化事件(orderly:此事件是否需要被有序处理)
+func Publish[T IEvent](event T, orderly ...bool) {
+	Ctl.Post(event, orderly...)
+}
+
+// ------------------------------------------------------------------------------
+func typeOf[T any]() reflect.Type { return reflect.TypeOf((*T)(nil)).Elem() }
+
+func wrapCall[T IEvent, R any](handle func(T) (R, error)) TCallHandler {
+	return func(event IEvent) (interface{}, error) { return handle(event.(T)) }
+}
+func wrapHandle[T IEvent](handle func(T)) TEventHandler {
+	return func(event IEvent) { handle(event.(T)) }
+}
+func wrapHandleE[T IEvent](handle func(T) error) TEventHandlerE {
+	return func(event IEvent) error { return handle(event.(T)) }
+}
@@ -1,11 +1,17 @@
 package evn
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudapex/ulib/log"
 	"github.com/cloudapex/ulib/util"
+
+	"github.com/duke-git/lancet/v2/mathutil"
 )
 
 // Task
@@ -14,36 +20,109 @@ type Task struct {
 	exit   chan int
 	queue  chan *task
 	handle TaskHandler
+
+	opt  *TaskOpt
+	warn interface {
+		Assert(value int64, v ...interface{})
+	} // 积压告警
+	spill   []*task // 溢出队列(EOV_Spill)
+	spilled atomic.Int32
+	spillMu util.Locker
+	notify  chan struct{}
+
+	sendMu   util.Locker   // 入队与清除已取消任务互斥
+	canceled atomic.Int32  // 仍在队列中的已取消任务数
+	freed    chan struct{} // 出队通知(唤醒阻塞的投递)
+
+	workers  atomic.Int32 // 当前工作协程数(弹性: 1~MaxWorkers)
+	spawned  atomic.Int64 // 累计扩容次数
+	retired  atomic.Int64 // 累计缩容次数
+	growAt   atomic.Int64 // 上次扩容时间(纳秒)
+	exitOnce sync.Once
+	stopped  chan struct{} // 所有工作协程退出后关闭
 }
 
-func (this *Task) Init(name string, capy int) *Task {
+func (this *Task) Init(name string, capy int, opt ...*TaskOpt) *Task {
 	this.name = name
-	this.exit, this.queue = make(chan int), make(chan *task, capy)
+	this.exit, this.queue, this.notify, this.stopped = make(chan int), make(chan *task, capy), make(chan struct{}, 1), make(chan struct{})
+	this.freed = make(chan struct{}, 1)
+	this.opt = util.Tern(len(opt) > 0 && util.DefaultVal(opt) != nil, util.DefaultVal(opt), &TaskOpt{})
+	if this.opt.WarnRate > 0 {
+		thName := fmt.Sprintf(log.C_TH_CHAN_OVERLOAD, "evn:"+name)
+		log.RegThreshold(thName, int64(mathutil.Max(capy*this.opt.WarnRate/100, 1)), C_TASK_WARN_INTERVAL, "task[%s] queue backlog")
+		this.warn = log.Threshold(thName)
+	}
 	return this
 }
 func (this *Task) Handler(handler TaskHandler) {
-	util.Cast(this.handle == nil, func() { this.handle = handler; go this.loop() }, nil)
+	util.Cast(this.handle == nil, func() { this.handle = handler; this.workers.Store(1); go this.loop() }, nil)
 }
 func (this *Task) HandleFunc(handFun TaskHandFunc) {
 	this.Handler(handFun)
 }
+
+// 投递任务(按溢出策略处理, 失败时通过donefun返回错误或记录日志)
 func (this *Task) Post(param interface{}, donefun_ ...func(result interface{}, err error)) {
-	var donefun func(result interface{}, err error)
-	if len(donefun_) > 0 {
-		donefun = donefun_[0]
+	err := this.TryPost(param, donefun_...)
+	if err == nil {
+		return
 	}
-	util.Cast(this.handle != nil, func() { this.queue <- &task{param, donefun} }, nil)
+	if donefun := util.DefaultVal(donefun_); donefun != nil {
+		donefun(nil, err)
+		return
+	}
+	log.WarnD(-1, "Task[%q] post task(%#v) err:%v", this.name, param, err)
+}
+
+// 投递任务(按溢出策略处理, 返回未能入队的原因)
+func (this *Task) TryPost(param interface{}, donefun_ ...func(result interface{}, err error)) error {
+	return this.push(context.Background(), &task{param: param, donefun: util.DefaultVal(donefun_)})
 }
+
+// 异步执行任务并返回结果(未开始执行前可通过Future.Cancel取消)
+func (this *Task) Go(param interface{}) *Future {
+	return this.goCtx(context.Background(), param)
+}
+
+// 执行任务并等待结果(ctx到期时取消尚未开始的任务, 阻塞投递也随ctx返回)
+//
+//	在本任务的处理器内调用会等待自身, 工作协程不足时直到ctx到期才返回
+func (this *Task) Call(ctx context.Context, param interface{}) (interface{}, error) {
+	f := this.goCtx(ctx, param)
+	ret, err := f.Wait(ctx)
+	util.Cast(ctx.Err() != nil, func() { f.Cancel() }, nil)
+	return ret, err
+}
+
+// 积压数量与容量(EOV_Spill时均含溢出队列, 不含已取消的)
+func (this *Task) Len() int {
+	return max(len(this.queue)+int(this.spilled.Load())-int(this.canceled.Load()), 0)
+}
+func (this *Task) Cap() int {
+	return cap(this.queue) + util.Tern(this.opt.Overflow == EOV_Spill, this.opt.SpillCapy, 0)
+}
+func (this *Task) Spilled() int { return int(this.spilled.Load()) }
+func (this *Task) Workers() int { return int(this.workers.Load()) }
+func (this *Task) Spawned() int { return int(this.spawned.Load()) }
+func (this *Task) Retired() int { return int(this.retired.Load()) }
 func (this *Task) Exit() {
+	ctx, cancel := context.WithTimeout(context.Background(), C_TASK_EXIT_TIME_OUT)
+	defer cancel()
+	if this.ExitC(ctx) != nil {
+		log.ErrorD(-1, "Task[%q] Exit Timeout", this.name)
+	}
+}
+func (this *Task) ExitC(ctx context.Context) error {
 	if this.handle == nil {
-		return
+		return nil
 	}
+	this.exitOnce.Do(func() { close(this.exit) })
 	select {
-	case this.exit <- 1:
-		return
-	case <-time.After(C_TASK_EXIT_TIME_OUT):
+	case <-this.stopped: // 各工作协程处理完当前任务后退出
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	log.ErrorD(-1, "Task[%q] Exit Timeout", this.name)
 }
 func (this *Task) loop() {
 	defer func() {
@@ -52,19 +131,251 @@ func (this *Task) loop() {
 		}
 	}()
 
+	var idle *time.Timer // 弹性模式: 空闲超时则缩容
+	var idleC <-chan time.Time
+	if this.opt.MaxWorkers > 1 && this.opt.IdleTime > 0 {
+		idle = time.NewTimer(this.opt.IdleTime)
+		defer idle.Stop()
+		idleC = idle.C
+	}
+
 	for {
 		select {
 		case <-this.exit:
+			util.Cast(this.workers.Add(-1) == 0, func() { close(this.stopped) }, nil)
 			return
 		case t := <-this.queue:
-			ret, err := this.handle.OnHandleTask(t.param)
-			if t.donefun == nil {
-				if err != nil {
-					log.ErrorD(-1, "Task[%q] handle task(%#v) err:%v", this.name, t.param, err)
-				}
-				continue
+			this.wake()
+			this.run(t)
+		case <-this.notify:
+			this.refill()
+		case <-idleC:
+			if this.shrink() {
+				return
 			}
-			t.donefun(ret, err)
 		}
+		util.Cast(idle != nil, func() { idle.Reset(this.opt.IdleTime) }, nil)
+	}
+}
+func (this *Task) run(t *task) {
+	util.Cast(this.spilled.Load() > 0, this.refill, nil)
+	if t.future != nil && !t.future.start() {
+		this.discard(t) // 已取消
+		return
+	}
+	ret, err := this.exec(t)
+	if t.donefun == nil {
+		if err != nil {
+			log.ErrorD(-1, "Task[%q] handle task(%#v) err:%v", this.name, t.param, err)
+		}
+		return
+	}
+	t.donefun(ret, err)
+}
+
+// ------------------------------------------------------------------------------
+// 执行任务(panic转为错误, 保证donefun被调用)
+func (this *Task) exec(t *task) (ret interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			util.Catch(fmt.Sprintf("Task[%q] handle task panic", this.name), x)
+			ret, err = nil, fmt.Errorf("panic: %v", x)
+		}
+	}()
+	return this.handle.OnHandleTask(t.param)
+}
+
+func (this *Task) goCtx(ctx context.Context, param interface{}) *Future {
+	f := newFuture()
+	f.task = this
+	if err := this.push(ctx, &task{param: param, donefun: f.complete, future: f}); err != nil {
+		f.complete(nil, err)
+	}
+	return f
+}
+
+// 按溢出策略入队(EOV_Block时ctx取消则放弃等待)
+func (this *Task) push(ctx context.Context, t *task) error {
+	if this.handle == nil {
+		return ErrTaskClosed
+	}
+	defer this.assert()
+	this.grow()
+
+	switch this.opt.Overflow {
+	case EOV_DropNewest:
+		if this.offer(t) {
+			return nil
+		}
+		return this.drop(t, ErrQueueFull)
+	case EOV_DropOldest:
+		for _, old := range this.evict(t) {
+			this.drop(old, ErrQueueEvicted)
+		}
+		return nil
+	case EOV_Spill:
+		return this.spillPost(t)
+	}
+
+	var timeout <-chan time.Time
+	if this.opt.Timeout > 0 {
+		timer := time.NewTimer(this.opt.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for !this.offer(t) {
+		select {
+		case <-this.freed:
+		case <-timeout:
+			return this.drop(t, ErrQueueTimeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	util.Cast(len(this.queue) < cap(this.queue), this.wake, nil) // 仍有空位则唤醒下一个等待者
+	return nil
+}
+
+// 入队(队列满时先清除已取消的任务), 返回是否成功
+func (this *Task) offer(t *task) bool {
+	defer this.sendMu.UnLock(this.sendMu.Lock())
+	return this.send(t)
+}
+
+// 挤出最旧的任务直到入队(已取消的直接清除), 返回被挤出的任务
+func (this *Task) evict(t *task) (olds []*task) {
+	defer this.sendMu.UnLock(this.sendMu.Lock())
+	for !this.send(t) {
+		select {
+		case old := <-this.queue:
+			util.Cast(!this.discard(old), func() { olds = append(olds, old) }, nil)
+		default:
+		}
+	}
+	return
+}
+
+// 需持有sendMu
+func (this *Task) send(t *task) bool {
+	select {
+	case this.queue <- t:
+		return true
+	default:
+	}
+	if this.canceled.Load() <= 0 {
+		return false
+	}
+	this.compact()
+	select {
+	case this.queue <- t:
+		return true
+	default:
+		return false
+	}
+}
+
+// 清除队列中已取消的任务(需持有sendMu, 其余任务按原顺序放回)
+func (this *Task) compact() {
+	lives := make([]*task, 0, len(this.queue))
+	for n := len(this.queue); n > 0; n-- {
+		select {
+		case t := <-this.queue:
+			util.Cast(!this.discard(t), func() { lives = append(lives, t) }, nil)
+		default:
+			n = 0
+		}
+	}
+	for _, t := range lives {
+		this.queue <- t
+	}
+}
+
+// 已取消的任务出队时计数减一, 返回是否已取消
+func (this *Task) discard(t *task) bool {
+	if t.future == nil || !t.future.Canceled() {
+		return false
+	}
+	this.canceled.Add(-1)
+	return true
+}
+
+// 通知阻塞的投递有空位
+func (this *Task) wake() {
+	select {
+	case this.freed <- struct{}{}:
+	default:
+	}
+}
+
+// 丢弃任务(被挤出的任务通过donefun通知, 新投递的由调用方处理)
+func (this *Task) drop(t *task, err error) error {
+	util.Cast(this.opt.OnDrop != nil, func() { this.opt.OnDrop(t.param, err) }, nil)
+	util.Cast(err == ErrQueueEvicted && t.donefun != nil, func() { t.donefun(nil, err) }, nil)
+	return err
+}
+
+// 弹性模式: 积压达到GrowRate时扩容(间隔不小于C_TASK_GROW_INTERVAL, 不超过MaxWorkers)
+func (this *Task) grow() {
+	if this.opt.MaxWorkers <= 1 || this.Len() < max(cap(this.queue)*this.opt.GrowRate/100, 1) {
+		return
+	}
+	now, last := time.Now().UnixNano(), this.growAt.Load()
+	if now-last < int64(C_TASK_GROW_INTERVAL) || !this.growAt.CompareAndSwap(last, now) {
+		return
+	}
+	for n := this.workers.Load(); n >= 1 && n < int32(this.opt.MaxWorkers); n = this.workers.Load() {
+		if this.workers.CompareAndSwap(n, n+1) {
+			this.spawned.Add(1)
+			this.scale(int(n+1), true)
+			go this.loop()
+			return
+		}
+	}
+}
+
+// 弹性模式: 空闲的工作协程退出(至少保留一个)
+func (this *Task) shrink() bool {
+	for n := this.workers.Load(); n > 1; n = this.workers.Load() {
+		if this.workers.CompareAndSwap(n, n-1) {
+			this.retired.Add(1)
+			this.scale(int(n-1), false)
+			return true
+		}
+	}
+	return false
+}
+func (this *Task) scale(workers int, grow bool) {
+	util.Cast(this.opt.OnScale != nil, func() { this.opt.OnScale(workers, grow) }, nil)
+}
+func (this *Task) assert() {
+	util.Cast(this.warn != nil, func() { this.warn.Assert(int64(this.Len()), this.name) }, nil)
+}
+
+// 溢出队列非空时新任务也进入溢出队列, 以保持顺序
+func (this *Task) spillPost(t *task) error {
+	defer this.spillMu.UnLock(this.spillMu.Lock())
+	if len(this.spill) == 0 && this.offer(t) {
+		return nil
+	}
+	if n := len(this.spill); n >= this.opt.SpillCapy { // 先清除已取消的
+		this.spill = slices.DeleteFunc(this.spill, this.discard)
+		this.spilled.Add(int32(len(this.spill) - n))
+	}
+	if len(this.spill) >= this.opt.SpillCapy {
+		return this.drop(t, ErrQueueFull)
+	}
+	this.spill = append(this.spill, t)
+	this.spilled.Add(1)
+	select {
+	case this.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+func (this *Task) refill() {
+	defer this.spillMu.UnLock(this.spillMu.Lock())
+	for len(this.spill) > 0 && (this.discard(this.spill[0]) || this.offer(this.spill[0])) {
+		this.spill[0], this.spill = nil, this.spill[1:]
+		this.spilled.Add(-1)
 	}
 }
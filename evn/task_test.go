@@ -0,0 +1,295 @@
+package evn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/util"
+)
+
+// 阻塞的任务: 首个任务开始执行后阻塞, 直到release
+func blockedTask(t *testing.T, capy int, opt *TaskOpt) (task *Task, release func(), handled func() []int) {
+	t.Helper()
+	var mu sync.Mutex
+	started, gate, list := make(chan struct{}), make(chan struct{}), []int{}
+	once := sync.Once{}
+	task = (&Task{}).Init(t.Name(), capy, opt)
+	task.HandleFunc(func(param interface{}) (interface{}, error) {
+		once.Do(func() { close(started); <-gate })
+		mu.Lock()
+		defer mu.Unlock()
+		list = append(list, param.(int))
+		return param, nil
+	})
+	task.Post(0)
+	<-started
+	t.Cleanup(task.Exit)
+	return task, sync.OnceFunc(func() { close(gate) }), func() []int { mu.Lock(); defer mu.Unlock(); return append([]int{}, list...) }
+}
+
+func TestTaskDropNewest(t *testing.T) {
+	task, release, _ := blockedTask(t, 2, &TaskOpt{Overflow: EOV_DropNewest})
+	defer release()
+	for i := 1; i <= 2; i++ {
+		if err := task.TryPost(i); err != nil {
+			t.Fatalf("post %d err:%v", i, err)
+		}
+	}
+	if err := task.TryPost(3); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expect ErrQueueFull, got %v", err)
+	}
+}
+
+func TestTaskDropOldest(t *testing.T) {
+	task, release, handled := blockedTask(t, 2, &TaskOpt{Overflow: EOV_DropOldest})
+	evicted := make(chan error, 1)
+	task.Post(1, func(ret interface{}, err error) { evicted <- err })
+	task.Post(2)
+	task.Post(3)
+	if err := <-evicted; !errors.Is(err, ErrQueueEvicted) {
+		t.Fatalf("expect ErrQueueEvicted, got %v", err)
+	}
+	release()
+	waitUntil(t, func() bool { return len(handled()) == 3 })
+	if got := handled(); got[1] != 2 || got[2] != 3 {
+		t.Fatalf("unexpected handled order %v", got)
+	}
+}
+
+func TestTaskBlockTimeout(t *testing.T) {
+	task, release, _ := blockedTask(t, 1, &TaskOpt{Timeout: 20 * time.Millisecond})
+	defer release()
+	task.Post(1)
+	if err := task.TryPost(2); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expect ErrQueueTimeout, got %v", err)
+	}
+}
+
+func TestTaskSpill(t *testing.T) {
+	task, release, handled := blockedTask(t, 1, &TaskOpt{Overflow: EOV_Spill, SpillCapy: 2})
+	for i := 1; i <= 3; i++ {
+		if err := task.TryPost(i); err != nil {
+			t.Fatalf("post %d err:%v", i, err)
+		}
+	}
+	if task.Spilled() != 2 || task.Len() != 3 || task.Cap() != 3 {
+		t.Fatalf("unexpected spilled:%d len:%d cap:%d", task.Spilled(), task.Len(), task.Cap())
+	}
+	if err := task.TryPost(4); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expect ErrQueueFull, got %v", err)
+	}
+	release()
+	waitUntil(t, func() bool { return len(handled()) == 4 })
+	for i, v := range handled() {
+		if v != i {
+			t.Fatalf("spill should keep order, got %v", handled())
+		}
+	}
+}
+
+func TestTaskCallTimeout(t *testing.T) {
+	task, release, _ := blockedTask(t, 2, nil)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := task.Call(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met in time")
+}
+
+func TestTaskCancelFreesQueue(t *testing.T) {
+	task, release, handled := blockedTask(t, 2, &TaskOpt{Overflow: EOV_DropNewest})
+	f1, f2 := task.Go(1), task.Go(2)
+	if task.Len() != 2 {
+		t.Fatalf("expect len 2, got %d", task.Len())
+	}
+	f1.Cancel()
+	f2.Cancel()
+	if task.Len() != 0 {
+		t.Fatalf("canceled tasks still counted, len %d", task.Len())
+	}
+	for i := 3; i <= 4; i++ {
+		if err := task.TryPost(i); err != nil {
+			t.Fatalf("post %d err:%v", i, err)
+		}
+	}
+	release()
+	waitUntil(t, func() bool { return len(handled()) == 3 })
+	if got := handled(); got[1] != 3 || got[2] != 4 {
+		t.Fatalf("unexpected handled %v", got)
+	}
+}
+
+func TestTaskDropOldestSkipsCanceled(t *testing.T) {
+	task, release, handled := blockedTask(t, 2, &TaskOpt{Overflow: EOV_DropOldest})
+	f := task.Go(1)
+	evicted := make(chan error, 1)
+	task.Post(2, func(ret interface{}, err error) { util.Cast(err != nil, func() { evicted <- err }, nil) })
+	f.Cancel()
+	task.Post(3)
+	select {
+	case err := <-evicted:
+		t.Fatalf("live task evicted: %v", err)
+	default:
+	}
+	release()
+	waitUntil(t, func() bool { return len(handled()) == 3 })
+	if got := handled(); got[1] != 2 || got[2] != 3 {
+		t.Fatalf("unexpected handled %v", got)
+	}
+}
+
+func TestTaskCallBlockedPost(t *testing.T) {
+	task, release, _ := blockedTask(t, 1, nil)
+	defer release()
+	task.Post(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := task.Call(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded while queue full, got %v", err)
+	}
+}
+
+func TestTaskElasticGrowShrink(t *testing.T) {
+	task, release, handled := blockedTask(t, 4, &TaskOpt{MaxWorkers: 2, IdleTime: 20 * time.Millisecond, GrowRate: 50})
+	for i := 1; i <= 3; i++ {
+		task.Post(i)
+	}
+	if task.Workers() != 2 || task.Spawned() != 1 {
+		t.Fatalf("expect grow to 2 workers, got workers:%d spawned:%d", task.Workers(), task.Spawned())
+	}
+	time.Sleep(C_TASK_GROW_INTERVAL)
+	task.Post(4)
+	if task.Workers() != 2 {
+		t.Fatalf("workers exceed MaxWorkers: %d", task.Workers())
+	}
+	release()
+	waitUntil(t, func() bool { return len(handled()) == 5 })
+	waitUntil(t, func() bool { return task.Workers() == 1 })
+	if task.Retired() != 1 {
+		t.Fatalf("expect 1 retired, got %d", task.Retired())
+	}
+}
+
+// 已安装未初始化时投递返回ErrNotInited(不panic)
+func TestControllerNotInited(t *testing.T) {
+	c := ctl.NewApp("notinit", "").DeferInit().Install(Controller(&Config{Size: 1})).(*controller)
+
+	c.Post(testEvent{})
+	if err := c.TryPost(testEvent{}); !errors.Is(err, ErrNotInited) {
+		t.Fatalf("expect ErrNotInited, got %v", err)
+	}
+	if _, err := c.Call(context.Background(), testEvent{}); !errors.Is(err, ErrNotInited) {
+		t.Fatalf("expect ErrNotInited, got %v", err)
+	}
+	if _, err := c.Request(testEvent{}).Wait(context.Background()); !errors.Is(err, ErrNotInited) {
+		t.Fatalf("expect ErrNotInited, got %v", err)
+	}
+}
+
+// 启用弹性池时固定任务可少于5个, 无序事件由弹性池处理
+func TestControllerElasticPool(t *testing.T) {
+	app := ctl.NewApp("pool", "")
+	c := app.Install(Controller(&Config{Size: 1, MaxWorkers: 4})).(*controller)
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	if len(c.tasks) != 1 || c.pool == nil {
+		t.Fatalf("expect 1 fixed task and a pool, got tasks:%d pool:%v", len(c.tasks), c.pool != nil)
+	}
+	pool, _ := c.route(testEvent{}, false)
+	first, _ := c.route(testEvent{}, true)
+	if pool != c.pool || first != c.tasks[0] {
+		t.Fatal("unexpected route")
+	}
+	detail, err := c.HandleHealth(context.Background())
+	if err != nil || !strings.Contains(detail, "pool:1/4") {
+		t.Fatalf("unexpected health %q err:%v", detail, err)
+	}
+}
+
+type keyEvent struct{ key string }
+
+func (keyEvent) EventId() TEventID      { return "test.key" }
+func (e keyEvent) PartitionKey() string { return e.key }
+
+// 同一分区键总是路由到同一任务, 且不占用有序任务tasks[0]
+func TestControllerPartitionRoute(t *testing.T) {
+	app := ctl.NewApp("partition", "")
+	c := app.Install(Controller(&Config{Size: 5})).(*controller)
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop()
+
+	used := map[*Task]bool{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		first, _ := c.route(keyEvent{key}, false)
+		again, _ := c.route(keyEvent{key}, true)
+		if first != again {
+			t.Fatalf("key %q routed to different tasks", key)
+		}
+		if first == c.tasks[0] {
+			t.Fatalf("key %q routed to orderly task", key)
+		}
+		used[first] = true
+	}
+	if len(used) != len(c.tasks)-1 {
+		t.Fatalf("keys should spread over tasks[1:], used %d", len(used))
+	}
+
+	// 仅一个固定任务(弹性池)时分区事件使用tasks[0]
+	app2 := ctl.NewApp("partition-pool", "")
+	c2 := app2.Install(Controller(&Config{Size: 1, MaxWorkers: 2})).(*controller)
+	if err := app2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer app2.Stop()
+	if task, _ := c2.route(keyEvent{"k"}, false); task != c2.tasks[0] {
+		t.Fatal("partitioned event should use the only fixed task")
+	}
+}
+
+// 关闭时按传入的关闭预算等待, 而非C_TASK_EXIT_TIME_OUT
+func TestControllerTermBudget(t *testing.T) {
+	app := ctl.NewApp("term-budget", "")
+	c := app.Install(Controller(&Config{Size: 1})).(*controller)
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	SubscribeTo(c, func(testEvent) { close(started); <-release })
+	c.Post(testEvent{})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := c.HandleTermC(ctx); err == nil {
+		t.Fatal("expect exit timeout")
+	}
+	if cost := time.Since(begin); cost >= C_TASK_EXIT_TIME_OUT {
+		t.Fatalf("term should follow ctx deadline, cost:%v", cost)
+	}
+}
@@ -0,0 +1,72 @@
+package evn
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudapex/ulib/util"
+)
+
+// 广播事件到其他进程
+func (this *controller) Broadcast(event IEvent) error {
+	if this.Conf.Transport == nil {
+		return ErrNoTransport
+	}
+	if err := this.Conf.Transport.Send(event); err != nil {
+		this.metRemote.With(this.App().Name(), "send_failed").Inc()
+		return err
+	}
+	this.metRemote.With(this.App().Name(), "sent").Inc()
+	return nil
+}
+
+// 启动接收(出错后间隔C_RECV_RETRY_DELAY重试, 直到stopRecv)
+func (this *controller) startRecv() {
+	if this.Conf.Transport == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	this.recvCancel, this.recvDone = cancel, make(chan struct{})
+
+	util.Goroutine(this.HandleName()+".recv", func() {
+		defer close(this.recvDone)
+		for ctx.Err() == nil {
+			err := this.Conf.Transport.Recv(ctx, this.deliver)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			this.Error("transport recv err:%v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(C_RECV_RETRY_DELAY):
+			}
+		}
+	})
+}
+
+// 停止接收(等待接收协程退出)
+func (this *controller) stopRecv(ctx context.Context) error {
+	if this.recvCancel == nil {
+		return nil
+	}
+	this.recvCancel()
+	select {
+	case <-this.recvDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 远端事件投递给本地任务, 处理完成后确认
+func (this *controller) deliver(event IEvent, ack func()) {
+	this.metRemote.With(this.App().Name(), "received").Inc()
+	task, err := this.route(event, false)
+	if err != nil {
+		this.Warn("remote event:%q not acked err:%v", event.EventId(), err)
+		return
+	}
+	task.Post(event, func(_ interface{}, err error) {
+		util.Cast(err == nil, ack, func() { this.Warn("remote event:%q not acked err:%v", event.EventId(), err) })
+	})
+}
@@ -0,0 +1,64 @@
+package htp
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/cloudapex/ulib/ctl"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 挂载管理路由(需携带令牌: 请求头C_ADMIN_HEADER; 不接受query参数, 以免令牌进入访问日志)
+//
+//	/inspect        ctl运行时快照(控制器, 定时任务, 事件处理器, 路由)
+//	/runtime        Go运行时统计
+//	/pprof/*        net/http/pprof
+//
+// app为内省的应用(默认ctl.Default())
+func MountAdmin(r gin.IRouter, token string, app ...*ctl.App) {
+	a := appOf(app)
+	g := r.Group("", adminAuth(token))
+	g.GET("/inspect", func(c *gin.Context) { c.JSON(http.StatusOK, a.Inspect()) })
+	g.GET("/runtime", adminRuntime)
+
+	g.GET("/pprof/", gin.WrapF(pprof.Index))
+	g.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	g.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	g.GET("/pprof/:name", func(c *gin.Context) { pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request) })
+}
+
+// --------------- internal
+
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(C_ADMIN_HEADER)
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+func adminRuntime(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	c.JSON(http.StatusOK, gin.H{
+		"goVersion":  runtime.Version(),
+		"numCPU":     runtime.NumCPU(),
+		"goMaxProcs": runtime.GOMAXPROCS(0),
+		"goroutines": runtime.NumGoroutine(),
+		"heapAlloc":  m.HeapAlloc,
+		"heapSys":    m.HeapSys,
+		"heapObjs":   m.HeapObjects,
+		"sys":        m.Sys,
+		"numGC":      m.NumGC,
+		"pauseTotal": m.PauseTotalNs,
+		"lastGC":     m.LastGC,
+	})
+}
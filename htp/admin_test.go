@@ -0,0 +1,98 @@
+package htp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(&log.Config{Level: log.ELL_Warns})
+	gin.SetMode(gin.TestMode)
+	code := m.Run()
+	log.Term()
+	os.Exit(code)
+}
+
+func adminServe(r http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(C_ADMIN_HEADER, token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	r := gin.New()
+	MountAdmin(r.Group(C_ADMIN_PATH), "secret", ctl.NewApp("admin-auth", "1.0.0"))
+	empty := gin.New()
+	MountAdmin(empty.Group(C_ADMIN_PATH), "")
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"missing":     adminServe(r, http.MethodGet, "/admin/runtime", ""),
+		"wrong":       adminServe(r, http.MethodGet, "/admin/runtime", "secre"),
+		"query":       adminServe(r, http.MethodGet, "/admin/runtime?token=secret", ""),
+		"empty token": adminServe(empty, http.MethodGet, "/admin/runtime", ""),
+	} {
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "invalid admin token") {
+			t.Errorf("%s: expect 401, got %d %s", name, w.Code, w.Body.String())
+		}
+	}
+	if w := adminServe(r, http.MethodGet, "/admin/runtime", "secret"); w.Code != http.StatusOK {
+		t.Fatalf("valid token: expect 200, got %d", w.Code)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	r := gin.New()
+	MountAdmin(r.Group(C_ADMIN_PATH), "secret", ctl.NewApp("admin-routes", "1.2.3"))
+
+	w := adminServe(r, http.MethodGet, "/admin/inspect", "secret")
+	snap := ctl.Snapshot{}
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("inspect: %d %s err:%v", w.Code, w.Body.String(), err)
+	}
+	if snap.App != "admin-routes" || snap.Version != "1.2.3" {
+		t.Fatalf("inspect should snapshot the given app, got %+v", snap)
+	}
+
+	w = adminServe(r, http.MethodGet, "/admin/runtime", "secret")
+	rt := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &rt); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("runtime: %d %s err:%v", w.Code, w.Body.String(), err)
+	}
+	for _, k := range []string{"goVersion", "numCPU", "goMaxProcs", "goroutines", "heapAlloc", "numGC"} {
+		if _, ok := rt[k]; !ok {
+			t.Fatalf("runtime missing %q: %v", k, rt)
+		}
+	}
+
+	for _, it := range []struct{ method, path, expect string }{
+		{http.MethodGet, "/admin/pprof/", "goroutine"},
+		{http.MethodGet, "/admin/pprof/cmdline", ""},
+		{http.MethodGet, "/admin/pprof/symbol", "num_symbols"},
+		{http.MethodPost, "/admin/pprof/symbol", "num_symbols"},
+		{http.MethodGet, "/admin/pprof/goroutine?debug=1", "goroutine profile"},
+		{http.MethodGet, "/admin/pprof/heap?debug=1", "heap profile"},
+		{http.MethodGet, "/admin/pprof/trace?seconds=0.05", ""},
+		{http.MethodGet, "/admin/pprof/profile?seconds=1", ""},
+	} {
+		w := adminServe(r, it.method, it.path, "secret")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), it.expect) {
+			t.Errorf("%s %s: %d %.100q", it.method, it.path, w.Code, w.Body.String())
+		}
+	}
+	if w := adminServe(r, http.MethodGet, "/admin/pprof/nonexistent", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown profile: expect 404, got %d", w.Code)
+	}
+}
@@ -2,6 +2,8 @@ package htp
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -16,15 +18,21 @@ import (
 	"golang.org/x/net/http2/h2c"
 )
 
-func Controller(conf *Config) IContrler { return &controller{Conf: conf} }
+// 创建控制器(groups为此控制器的路由组; 包级Register注册的路由组仅挂载到默认应用)
+func Controller(conf *Config, groups ...IGroupRouter) IContrler {
+	return &controller{Conf: conf, routers: groups}
+}
 
 // > htp control
 type controller struct {
 	log.ILoger
+	ctl.AppBind
 
-	ser http.Server
+	ser    http.Server
+	engine *gin.Engine
 
-	groups []IGroupRouter
+	groups  []IGroupRouter
+	routers []IGroupRouter // 创建时指定的路由组
 
 	Conf *Config
 }
@@ -32,41 +40,99 @@ type controller struct {
 func (this *controller) HandleName() string { return "htp" }
 
 func (this *controller) HandleInit() {
-	this.ILoger = ctl.Logger(this.HandleName())
-	util.Cast(this.Conf == nil, func() { this.Fatal("conf = nil") }, nil)
+	if err := this.HandleInitE(); err != nil {
+		this.Fatal("init err:%v", err)
+	}
+}
+func (this *controller) HandleInitE() error {
+	this.ILoger = this.App().Logger(this.HandleName())
+	if this.Conf == nil {
+		return fmt.Errorf("conf = nil")
+	}
 
-	util.Cast(len(units) != 0, func() { this.groups = append(this.groups, units...) }, nil)
+	this.ser, this.groups = http.Server{}, nil
+	util.Cast(this.App() == ctl.Default(), func() { this.groups = append(this.groups, units...) }, nil)
+	this.groups = append(this.groups, this.routers...)
 
 	gin.SetMode(this.Conf.RunMode)
 	gin.DefaultWriter, gin.DefaultErrorWriter = &GinLogger{}, &GinRecover{}
 
-	this.initRouter()
-	this.startServer()
+	if err := this.initRouter(); err != nil {
+		return err
+	}
+	return this.startServer()
 }
 func (this *controller) HandleTerm() {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), C_SHUT_TIME_OUT)
 	defer cancel()
-	if err := this.ser.Shutdown(ctx); err != nil {
+	if err := this.HandleTermC(ctx); err != nil {
 		this.Error("shutdown err:%v", err)
 	}
 }
+func (this *controller) HandleTermC(ctx context.Context) error {
+	return this.ser.Shutdown(ctx)
+}
+
+func (this *controller) HandleReload(old, new *ctl.ConfSection) error {
+	c := &Config{}
+	if err := new.Decode(c); err != nil {
+		return err
+	}
+
+	unsupports := []string{}
+	if c.RunMode != this.Conf.RunMode || c.Probe != this.Conf.Probe || c.Metrics != this.Conf.Metrics || c.WaitReady != this.Conf.WaitReady || c.Admin != this.Conf.Admin {
+		unsupports = append(unsupports, "runMode|probe|metrics|waitReady|admin")
+	}
+	if c.ListenAddr != this.Conf.ListenAddr || c.ListnTls != this.Conf.ListnTls {
+		unsupports = append(unsupports, "listenAddr|listnTls")
+	}
+	if c.ReadTimeout != this.Conf.ReadTimeout || c.WriteTimeout != this.Conf.WriteTimeout { // http.Server服务中读取, 不可并发修改
+		unsupports = append(unsupports, "readTimeout|writeTimeout")
+	}
+	if len(unsupports) > 0 {
+		return fmt.Errorf("config%v can not be reloaded: %w", unsupports, ctl.ErrRestartOnly)
+	}
+	return nil
+}
+
+// 路由列表(method path handler)
+func (this *controller) HandleInspect() interface{} {
+	routes := []string{}
+	if this.engine != nil {
+		for _, it := range this.engine.Routes() {
+			routes = append(routes, fmt.Sprintf("%s %s %s", it.Method, it.Path, it.Handler))
+		}
+	}
+	return map[string]interface{}{"listenAddr": this.Conf.ListenAddr, "routes": routes}
+}
 
 // ==================== internal
 
-func (this *controller) initRouter() {
+func (this *controller) initRouter() error {
 	this.TraceD(-1, "Start init GroupRouter(%d)...", len(this.groups))
 	defer this.InfoD(-1, "Init GroupRouter(%d) done.", len(this.groups))
 
 	r := gin.New()
 	util.Cast(this.Conf.RunMode == "debug", func() { r.Use(gin.Logger()) }, nil)
+	util.Cast(this.Conf.Metrics, func() { r.Use(Metrics(this.App())) }, nil)
 	r.Use(gin.Recovery())
+	util.Cast(this.Conf.Probe, func() { MountProbe(r, this.App()) }, nil)
+	util.Cast(this.Conf.Metrics, func() { MountMetrics(r) }, nil)
+	if this.Conf.Admin.Enable {
+		if this.Conf.Admin.Token == "" {
+			return fmt.Errorf("admin enabled but token is empty")
+		}
+		MountAdmin(r.Group(util.Tern(this.Conf.Admin.Path != "", this.Conf.Admin.Path, C_ADMIN_PATH)), this.Conf.Admin.Token, this.App())
+	}
+	util.Cast(this.Conf.WaitReady, func() { r.Use(ReadyGate(this.App())) }, nil) // 之后注册的路由才受门控
+	this.engine = r
 
 	this.ser.Handler = h2c.NewHandler(r, &http2.Server{})
 
 	// 1. init root router
 	for _, it := range this.groups {
 		if it.Name() == "" {
-			this.Fatal("routerGroup.Name() is empty. type:%#v", it)
+			return fmt.Errorf("routerGroup.Name() is empty. type:%#v", it)
 		}
 		if strutil.ContainsAny(it.Name(), []string{".", "/"}) { // match root router
 			it.Init(&GroupRouter{RouterGroup: &r.RouterGroup})
@@ -77,7 +143,7 @@ func (this *controller) initRouter() {
 	existeds := map[string]*GroupRouter{}
 	for _, it := range this.groups {
 		if it.Name() == "" {
-			this.Fatal("routerGroup.Name() is empty. type:%#v", it)
+			return fmt.Errorf("routerGroup.Name() is empty. type:%#v", it)
 		}
 
 		if strutil.ContainsAny(it.Name(), []string{".", "/"}) { // match root router
@@ -90,10 +156,10 @@ func (this *controller) initRouter() {
 		}
 		it.Init(existeds[it.Name()])
 	}
+	return nil
 }
-func (this *controller) startServer() {
+func (this *controller) startServer() error {
 	this.TraceD(-1, "Start htp server...")
-	defer this.InfoD(-1, "Start htp server on listen addr:%q", this.Conf.ListenAddr)
 
 	this.ser.Addr = this.Conf.ListenAddr
 	this.ser.ReadHeaderTimeout = 2 * time.Second // 读取请求头超时时间
@@ -103,18 +169,28 @@ func (this *controller) startServer() {
 	this.ser.WriteTimeout = time.Duration(mathutil.Max(10, this.Conf.WriteTimeout)) * time.Second
 	this.ser.SetKeepAlivesEnabled(true)
 
+	// 同步监听, 以便端口占用等错误在初始化时返回
+	addr := this.ser.Addr
+	util.Cast(addr == "", func() { addr = util.Tern(this.Conf.ListnTls.Enable, ":https", ":http") }, nil)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen addr:%q err:%v", this.Conf.ListenAddr, err)
+	}
+
 	if !this.Conf.ListnTls.Enable {
 		go func() {
-			if err := this.ser.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				this.Fatal("Gin run err:%v", err)
+			if err := this.ser.Serve(ln); err != nil && err != http.ErrServerClosed {
+				ctl.Fail(fmt.Errorf("htp serve err:%v", err))
 			}
 		}()
 	} else {
 		go func() {
-			err := this.ser.ListenAndServeTLS(this.Conf.ListnTls.CrtFile, this.Conf.ListnTls.KeyFile)
+			err := this.ser.ServeTLS(ln, this.Conf.ListnTls.CrtFile, this.Conf.ListnTls.KeyFile)
 			if err != nil && err != http.ErrServerClosed {
-				this.Fatal("Gin run with TLS err:%v", err)
+				ctl.Fail(fmt.Errorf("htp serve with TLS err:%v", err))
 			}
 		}()
 	}
+	this.InfoD(-1, "Start htp server on listen addr:%q", this.Conf.ListenAddr)
+	return nil
 }
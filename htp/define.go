@@ -13,13 +13,28 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	C_SHUT_TIME_OUT = 3 * time.Second // 未指定上下文时的关闭超时
+	C_ADMIN_PATH    = "/admin"        // 管理路由组默认路径
+	C_ADMIN_HEADER  = "X-Admin-Token" // 管理路由令牌请求头
+)
+
 // > 配置项
 type Config struct {
 	RunMode      string    `json:"runMode"` // debug release
 	ListenAddr   string    `json:"listenAddr"`
-	WriteTimeout int       `json:"writeTimeout"` // second
-	ReadTimeout  int       `json:"readTimeout"`  // second
+	WriteTimeout int       `json:"writeTimeout"` // second(需重启生效)
+	ReadTimeout  int       `json:"readTimeout"`  // second(需重启生效)
 	ListnTls     ListenTLS `json:"listnTls"`
+	Probe        bool      `json:"probe"`     // 是否挂载探针路由(/healthz /readyz /livez)
+	Metrics      bool      `json:"metrics"`   // 是否统计请求指标并挂载/metrics路由
+	WaitReady    bool      `json:"waitReady"` // 应用就绪(预热完成)前业务路由返回503(探针,指标,管理路由除外)
+	Admin        AdminConf `json:"admin"`     // 管理路由组(运行时快照, runtime统计, pprof)
+}
+type AdminConf struct {
+	Enable bool   `json:"enable"`
+	Path   string `json:"path"`  // 路由组路径(默认C_ADMIN_PATH)
+	Token  string `json:"token"` // 访问令牌(启用时必填)
 }
 type ListenTLS struct {
 	Enable  bool   `json:"enable"`
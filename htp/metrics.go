@@ -0,0 +1,43 @@
+package htp
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/met"
+	"github.com/cloudapex/ulib/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	metRequests = ctl.Metrics("htp").NewCounter("requests_total", "HTTP requests by route, status and ECode.", "app", "method", "route", "status", "ecode")
+	metLatency  = ctl.Metrics("htp").NewHistogram("request_seconds", "HTTP request latency by route.", nil, "app", "method", "route")
+)
+
+// 挂载指标路由(/metrics, Prometheus文本格式)
+func MountMetrics(r gin.IRoutes) {
+	r.GET("/metrics", gin.WrapH(met.Handler()))
+}
+
+// 请求指标中间件(按路由模板统计, 未匹配的路由归为"unmatched"; app为空则为默认应用)
+func Metrics(app ...*ctl.App) gin.HandlerFunc {
+	name := ctl.AppName()
+	util.Cast(util.DefaultVal(app) != nil, func() { name = app[0].Name() }, nil)
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ecode := ""
+		if rsp := CtxResponseGet(c); rsp != nil {
+			ecode = strconv.Itoa(rsp.Code)
+		}
+		metRequests.With(name, c.Request.Method, route, strconv.Itoa(c.Writer.Status()), ecode).Inc()
+		metLatency.With(name, c.Request.Method, route).ObserveSince(start)
+	}
+}
@@ -0,0 +1,60 @@
+package htp
+
+import (
+	"net/http"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 挂载探针路由
+//
+//	/healthz 所有检查项健康返回200, 否则503
+//	/readyz  已就绪(启动完成且未开始关闭)并且健康返回200, 否则503
+//	/livez   进程存活即返回200
+//
+// app为探测的应用(默认ctl.Default())
+func MountProbe(r gin.IRoutes, app ...*ctl.App) {
+	a := appOf(app)
+	r.GET("/healthz", func(c *gin.Context) { probeHealth(a, c) })
+	r.GET("/readyz", func(c *gin.Context) { probeReady(a, c) })
+	r.GET("/livez", probeLive)
+}
+
+// 就绪门控中间件(应用未就绪时返回503, 用于预热完成前拒绝业务流量)
+func ReadyGate(app *ctl.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !app.Ready() {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "service not ready"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// --------------- internal
+
+func appOf(app []*ctl.App) *ctl.App {
+	if a := util.DefaultVal(app); a != nil {
+		return a
+	}
+	return ctl.Default()
+}
+func probeHealth(app *ctl.App, c *gin.Context) {
+	report := app.Health(c.Request.Context())
+	c.JSON(util.Tern(report.Healthy, http.StatusOK, http.StatusServiceUnavailable), report)
+}
+func probeReady(app *ctl.App, c *gin.Context) {
+	if !app.Ready() {
+		c.JSON(http.StatusServiceUnavailable, &ctl.HealthReport{Ready: false})
+		return
+	}
+	report := app.Health(c.Request.Context())
+	c.JSON(util.Tern(report.Healthy && report.Ready, http.StatusOK, http.StatusServiceUnavailable), report)
+}
+func probeLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"alive": true, "lived": util.TimeLived().String()})
+}
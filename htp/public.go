@@ -23,7 +23,13 @@ func Install(conf *Config) ctl.IControler {
 	return c
 }
 
-// 注册路由组对象
+// 获取指定应用中安装的控制器(未安装则为nil)
+func Of(app *ctl.App) IContrler {
+	c, _ := app.Controler("htp").(IContrler)
+	return c
+}
+
+// 注册路由组对象(挂载到默认应用的控制器; 其他应用通过Controller(conf, groups...)指定)
 func Register(r IGroupRouter) {
 	if index := hasRouterUnit(r.Name()); index >= 0 {
 		panic(fmt.Errorf("! Register IGroupRouter name:%q is already existed.", r.Name()))
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -14,14 +15,20 @@ const (
 	C_LOG_ROTATE_NUM  = 3                // 默认日志文件轮换数量
 	C_LOG_ROTATE_SIZE = 20 * 1024 * 1024 // 默认日志文件轮换size
 	C_LOG_CSIZE       = 2048             // 默认日志消息ChanSize
+	C_LOG_PUSH_WAIT   = 1 * time.Second  // 消息队列满时的最长等待(超时丢弃, 计入log_dropped_total{reason="overflow"}; Error/Fatal不丢弃, 阻塞等待)
 
 	C_TH_CHAN_OVERLOAD       = "Threshold:%s"    // 消息积压阀值名称
 	C_TH_CHAN_OVERLOAD_VALUE = C_LOG_CSIZE * 0.8 // 消息积压阀值(过大时告警)
 )
 
+var (
+	ErrRestartOnly = errors.New("restart required") // 热更时仅需重启才能生效的配置项(作为警告报告, 不视为失败)
+)
+
 var (
 	LOG_MSG_LV_PREFIXS = [ELL_Max]string{"[TRC]", "[DBG]", "[INF]", "[WRN]", "[ERR]", "[FAL]"} // fail
 	LOG_MSG_COLORS     = [ELL_Max]int{97, 94, 92, 93, 91, 95}                                  // colors
+	LOG_MSG_LV_NAMES   = [ELL_Max]string{"trace", "debug", "info", "warn", "error", "fatal"}   // json level
 )
 
 // ==================== 类型定义
@@ -43,6 +50,12 @@ func (e ELogLevel) String() string {
 	}
 	return fmt.Sprintf("ELL_Unkonw(%d)", e)
 }
+func (e ELogLevel) name() string {
+	if e >= ELL_Trace && e < ELL_Max {
+		return LOG_MSG_LV_NAMES[e]
+	}
+	return fmt.Sprintf("level(%d)", e)
+}
 
 // 日志运行状态
 type ELoggerStatus int //
@@ -85,8 +98,20 @@ func (e ELogMode) String() string {
 	return strings.Join(str, "+")
 }
 
+// 日志输出格式
+type ELogFormat string //
+const (
+	ELF_Text ELogFormat = "text" // 文本(屏幕带颜色)
+	ELF_Json ELogFormat = "json" // JSON Lines(每行一个对象, 字段为顶层键)
+)
+
 // ==================== 接口定义
 
+// 日志编码器(screen:是否输出到屏幕; 返回不含换行的一行)
+type IEncoder interface {
+	Encode(msg *LogUnit, screen bool) string
+}
+
 // ILoger interface
 type ILoger interface {
 
@@ -137,20 +162,27 @@ type ILoger interface {
 // 日志单元
 type LogUnit struct {
 	Lv     ELogLevel
-	Str    string
+	Str    string // 文本格式(等级,调用位置,字段,消息; 字段仅在使用文本编码器时写入)
 	At     time.Time
 	Fields map[string]interface{}
+
+	Msg  string // 消息
+	File string // 调用位置(depth>0时)
+	Line int
+	Func string
 }
 
 // 日志配置
 type Config struct {
-	Level      ELogLevel `json:"lv"`         // 日志等级[ELL_Debug]
-	OutMode    ELogMode  `json:"mode"`       // 日志输出模式
-	DirName    string    `json:"dir"`        // 输出目录[默认在程序所在目录]
-	FileName   string    `json:"fileName"`   // 日志文件主名[程序本身名]
-	FileSuffix string    `json:"fileSuffix"` // 日志文件后缀[log]
-	RotateMax  int       `json:"rotateMax"`  // 日志文件轮换数量[3]
-	RotateSize int       `json:"rotateSize"` // 日志文件轮换大小[20m]
+	Level      ELogLevel  `json:"lv"`         // 日志等级[ELL_Debug]
+	OutMode    ELogMode   `json:"mode"`       // 日志输出模式
+	DirName    string     `json:"dir"`        // 输出目录[默认在程序所在目录]
+	FileName   string     `json:"fileName"`   // 日志文件主名[程序本身名]
+	FileSuffix string     `json:"fileSuffix"` // 日志文件后缀[log]
+	RotateMax  int        `json:"rotateMax"`  // 日志文件轮换数量[3]
+	RotateSize int        `json:"rotateSize"` // 日志文件轮换大小[20m]
+	Format     ELogFormat `json:"format"`     // 输出格式[ELF_Text]
+	Encoder    IEncoder   `json:"-"`          // 自定义编码器(优先于Format)
 }
 
 // 灰日志配置
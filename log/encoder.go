@@ -0,0 +1,98 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TextEncoder 文本编码(屏幕: 颜色+日期时间; 文件: 时间)
+func TextEncoder() IEncoder { return textEncoder{} }
+
+// JsonEncoder JSON Lines编码(ts,level,file,line,func,msg及各字段为顶层键; 与保留键同名的字段加"_"前缀)
+// 屏幕为终端时按等级着色, 否则(如被采集的标准错误输出)保持纯JSON Lines
+func JsonEncoder() IEncoder { return jsonEncoder{color: isTerminal(os.Stderr)} }
+
+// 按配置选择编码器
+func encoderOf(format ELogFormat, encoder IEncoder) IEncoder {
+	if encoder != nil {
+		return encoder
+	}
+	if format == ELF_Json {
+		return JsonEncoder()
+	}
+	return TextEncoder()
+}
+
+// ------------------------------------------------------------------------------
+type textEncoder struct{}
+
+func (textEncoder) Encode(msg *LogUnit, screen bool) string {
+	if screen {
+		return fmt.Sprintf("\x1b[%dm", LOG_MSG_COLORS[msg.Lv]) + " " + msg.At.Format("2006-01-02 15:04:05.000") + " " + msg.Str + " \x1b[0m"
+	}
+	return msg.At.Format("15:04:05.000") + " " + msg.Str
+}
+
+type jsonEncoder struct {
+	color bool // 屏幕输出着色
+}
+
+var jsonReserved = map[string]bool{"ts": true, "level": true, "file": true, "line": true, "func": true, "msg": true}
+
+func (this jsonEncoder) Encode(msg *LogUnit, screen bool) string {
+	b := newBuffer()
+	defer bufPool.Put(b)
+
+	b.WriteByte('{')
+	jsonKV(b, "ts", msg.At.Format(time.RFC3339Nano))
+	jsonKV(b, "level", msg.Lv.name())
+	if msg.File != "" {
+		jsonKV(b, "file", msg.File)
+		jsonKV(b, "line", msg.Line)
+		jsonKV(b, "func", msg.Func)
+	}
+	jsonKV(b, "msg", strings.TrimRight(msg.Msg, "\n"))
+
+	keys := make([]string, 0, len(msg.Fields))
+	for k := range msg.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := k
+		for jsonReserved[key] {
+			key = "_" + key
+		}
+		jsonKV(b, key, msg.Fields[k])
+	}
+	b.WriteByte('}')
+	if screen && this.color {
+		return fmt.Sprintf("\x1b[%dm", LOG_MSG_COLORS[msg.Lv]) + b.String() + "\x1b[0m"
+	}
+	return b.String()
+}
+
+// 是否为终端(字符设备)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func jsonKV(b *bytes.Buffer, key string, val interface{}) {
+	if b.Len() > 1 {
+		b.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(val)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(val))
+	}
+	b.Write(k)
+	b.WriteByte(':')
+	b.Write(v)
+}
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testUnit() *LogUnit {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	return &LogUnit{Lv: ELL_Warns, At: at, Msg: "hello\n", File: "ulib/log/x.go", Line: 12, Func: "Run",
+		Fields: map[string]interface{}{"ctrl": "htp", "msg": "shadow", "n": 3}}
+}
+
+func TestTextEncoder(t *testing.T) {
+	unit := testUnit()
+	unit.Str = unitStr(unit, true)
+	if expect := `[WRN] ulib/log/x.go:12|Run() >{"ctrl":"htp","msg":"shadow","n":3}< hello` + "\n"; unit.Str != expect {
+		t.Fatalf("unexpected str %q", unit.Str)
+	}
+	if got := TextEncoder().Encode(unit, false); got != unit.At.Format("15:04:05.000")+" "+unit.Str {
+		t.Fatalf("unexpected file line %q", got)
+	}
+	if got := TextEncoder().Encode(unit, true); !strings.HasPrefix(got, "\x1b[93m 2024-05-06 07:08:09.123 [WRN]") || !strings.HasSuffix(got, "\x1b[0m") {
+		t.Fatalf("unexpected screen line %q", got)
+	}
+
+	// 非文本编码器不序列化字段
+	if str := unitStr(unit, false); str != "[WRN] ulib/log/x.go:12|Run() hello\n" {
+		t.Fatalf("fields should be skipped, got %q", str)
+	}
+}
+
+func TestJsonEncoder(t *testing.T) {
+	unit := testUnit()
+	line := jsonEncoder{}.Encode(unit, false)
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &out); err != nil {
+		t.Fatalf("invalid json %q: %v", line, err)
+	}
+	expect := map[string]interface{}{
+		"ts": "2024-05-06T07:08:09.123Z", "level": "warn", "file": "ulib/log/x.go", "line": 12.0, "func": "Run",
+		"msg": "hello", "ctrl": "htp", "_msg": "shadow", "n": 3.0,
+	}
+	if len(out) != len(expect) {
+		t.Fatalf("unexpected keys %v", out)
+	}
+	for k, v := range expect {
+		if out[k] != v {
+			t.Fatalf("key %q expect %v, got %v", k, v, out[k])
+		}
+	}
+
+	// 屏幕: 终端着色, 否则与文件一致
+	if got := (jsonEncoder{}).Encode(unit, true); got != line {
+		t.Fatalf("screen without color should be plain json, got %q", got)
+	}
+	colored := jsonEncoder{color: true}.Encode(unit, true)
+	if colored != "\x1b[93m"+line+"\x1b[0m" {
+		t.Fatalf("unexpected colored line %q", colored)
+	}
+	if got := (jsonEncoder{color: true}).Encode(unit, false); got != line {
+		t.Fatalf("file line should not be colored, got %q", got)
+	}
+}
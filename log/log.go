@@ -10,7 +10,15 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/cloudapex/ulib/met"
+)
+
+var (
+	metMessages = met.NewCounter("log_messages_total", "Log messages by level.", "level")
+	metDropped  = met.NewCounter("log_dropped_total", "Log messages dropped by reason.", "reason")
 )
 
 func New(conf *Config) *logger { return (&logger{}).init(conf) }
@@ -27,6 +35,8 @@ type logger struct {
 	rotateSize       int
 	levelPrefixNames [ELL_Max]string
 	filters          []func(msg *LogUnit) bool
+	encoder          IEncoder
+	textStr          atomic.Bool // 当前为文本编码器(push时才将字段写入Str)
 
 	screenLogger    *log.Logger
 	fileSystmHandle *os.File
@@ -35,6 +45,7 @@ type logger struct {
 	fileLogiclogger *log.Logger
 
 	chanMsgs chan *LogUnit
+	chanCall chan func()
 	chanExit chan int
 	wgExit   sync.WaitGroup
 
@@ -53,7 +64,9 @@ func (this *logger) init(conf *Config) *logger {
 	this.fileSuffix = C_LOG_FILE_SUFFIX
 	this.rotateMax, this.rotateSize = C_LOG_ROTATE_NUM, C_LOG_ROTATE_SIZE
 	this.levelPrefixNames = LOG_MSG_LV_PREFIXS
+	this.setEncoder(TextEncoder())
 	this.chanMsgs = make(chan *LogUnit, C_LOG_CSIZE)
+	this.chanCall = make(chan func())
 	this.chanExit = make(chan int)
 
 	// threshold
@@ -74,12 +87,7 @@ func (this *logger) init(conf *Config) *logger {
 	}
 	this.level = conf.Level
 	if conf.DirName != "" {
-		if strings.HasPrefix(conf.DirName, "./") {
-			this.dirName = conf.DirName
-		} else {
-			_path, _ := filepath.Abs(filepath.Dir(os.Args[0]))
-			this.dirName = path.Join(_path, conf.DirName)
-		}
+		this.dirName = confDir(conf.DirName)
 	}
 	if conf.FileName != "" {
 		this.fileName = conf.FileName
@@ -93,6 +101,7 @@ func (this *logger) init(conf *Config) *logger {
 	if conf.RotateSize > 1024 {
 		this.rotateSize = conf.RotateSize
 	}
+	this.setEncoder(encoderOf(conf.Format, conf.Encoder))
 	return this
 }
 func (this *logger) Start() *logger {
@@ -101,23 +110,9 @@ func (this *logger) Start() *logger {
 	}
 
 	if this.outMode&ELM_File != 0 {
-		if err := os.MkdirAll(this.dirName, 0777); err != nil {
-			panic(err)
-		}
-
-		path := fmt.Sprintf("%s/%s_%s.%s", this.dirName, this.fileName, "system", this.fileSuffix)
-
-		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0777)
-		if err != nil {
+		if err := this.openFiles(); err != nil {
 			panic(err)
 		}
-		this.fileSystmHandle = file
-		this.fileSystmLogger = log.New(file, "", log.LstdFlags)
-		this.fileSystmLogger.Println("👌")
-
-		this.fileLogicUpdate()
-		this.fileLogiclogger.Println("·································START·································")
-		this.fileLogiclogger.Println() // add space line
 	}
 
 	go this.loop()
@@ -135,6 +130,52 @@ func (this *logger) Stop() {
 	this.wgExit.Wait()
 }
 
+// 热更配置(等级,输出模式,轮换参数,输出格式可热更; 目录,文件名,后缀变更返回错误)
+func (this *logger) Reload(conf *Config) error {
+	if this.status != ELS_Running {
+		return fmt.Errorf("logger not running")
+	}
+	unsupports := []string{}
+	if conf.DirName != "" && confDir(conf.DirName) != this.dirName {
+		unsupports = append(unsupports, "dir")
+	}
+	if conf.FileName != "" && conf.FileName != this.fileName {
+		unsupports = append(unsupports, "fileName")
+	}
+	if conf.FileSuffix != "" && conf.FileSuffix != this.fileSuffix {
+		unsupports = append(unsupports, "fileSuffix")
+	}
+
+	done := make(chan error, 1)
+	this.chanCall <- func() {
+		if conf.OutMode != 0 && conf.OutMode&ELM_File != 0 && this.fileSystmHandle == nil {
+			if err := this.openFiles(); err != nil {
+				done <- err
+				return
+			}
+		}
+		if conf.OutMode != 0 {
+			this.outMode = conf.OutMode
+		}
+		if conf.RotateMax > 0 {
+			this.rotateMax = conf.RotateMax
+		}
+		if conf.RotateSize > 1024 {
+			this.rotateSize = conf.RotateSize
+		}
+		this.level = conf.Level
+		this.setEncoder(encoderOf(conf.Format, conf.Encoder))
+		done <- nil
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	if len(unsupports) > 0 {
+		return fmt.Errorf("log config %v can not be reloaded: %w", unsupports, ErrRestartOnly)
+	}
+	return nil
+}
+
 func (this *logger) GetLevel() ELogLevel { return this.level }
 
 func (this *logger) SetLevel(lv ELogLevel) { this.level = lv }
@@ -238,25 +279,90 @@ func (this *logger) Fatalv(depth int, fields map[string]interface{}, v ...interf
 }
 
 // --------------- Internal logic
+func (this *logger) openFiles() error {
+	if err := os.MkdirAll(this.dirName, 0777); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/%s_%s.%s", this.dirName, this.fileName, "system", this.fileSuffix)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	this.fileSystmHandle = file
+	this.fileSystmLogger = log.New(file, "", log.LstdFlags)
+	this.fileSystmLogger.Println("👌")
+
+	this.fileLogicUpdate()
+	this.banner("·································START·································")
+	return nil
+}
 func (this *logger) push(level ELogLevel, depth int, fields map[string]interface{}, msg string) {
 	if this.status != ELS_Running {
+		metDropped.With("stopped").Inc()
+		return
+	}
+	metMessages.With(strings.Trim(level.String(), "[]")).Inc()
+
+	unit := &LogUnit{Lv: level, At: time.Now(), Fields: fields, Msg: msg}
+	if depth > 0 {
+		unit.File, unit.Line, unit.Func = stack(depth)
+	}
+	unit.Str = unitStr(unit, this.textStr.Load())
+	switch {
+	case level >= ELL_Error: // 错误与致命日志不丢弃, 积压时阻塞等待
+		this.chanMsgs <- unit
+	case !this.tryPush(unit):
+		metDropped.With("overflow").Inc()
 		return
 	}
+	Threshold(fmt.Sprintf(C_TH_CHAN_OVERLOAD, this.fileName)).Assert(int64(len(this.chanMsgs)))
+}
+
+func (this *logger) setEncoder(encoder IEncoder) {
+	this.encoder = encoder
+	_, ok := encoder.(textEncoder)
+	this.textStr.Store(ok)
+}
+
+// 文本格式(等级,调用位置,字段,消息; 字段仅在withFields时序列化, 其他编码器直接使用Fields)
+func unitStr(unit *LogUnit, withFields bool) string {
 	strFields := ""
-	if len(fields) > 0 {
-		b, _ := json.Marshal(fields)
+	if withFields && len(unit.Fields) > 0 {
+		b, _ := json.Marshal(unit.Fields)
 		strFields = fmt.Sprintf(">%s< ", string(b))
 	}
+	if unit.File != "" {
+		return fmt.Sprintf("%s %s:%d|%s() %s%s", unit.Lv.String(), unit.File, unit.Line, unit.Func, strFields, unit.Msg)
+	}
+	return fmt.Sprintf("%s %s%s", unit.Lv.String(), strFields, unit.Msg)
+}
+
+// 入队(积压时有限等待, 超时返回false)
+func (this *logger) tryPush(unit *LogUnit) bool {
+	select {
+	case this.chanMsgs <- unit:
+		return true
+	default:
+	}
+	t := time.NewTimer(C_LOG_PUSH_WAIT)
+	defer t.Stop()
+	select {
+	case this.chanMsgs <- unit:
+		return true
+	case <-t.C:
+		return false
+	}
+}
 
-	unit := &LogUnit{Lv: level, At: time.Now(), Fields: fields}
-	if depth > 0 {
-		file, line, fun := stack(depth)
-		unit.Str = fmt.Sprintf("%s %s:%d|%s() %s%s", level.String(), file, line, fun, strFields, msg)
-	} else {
-		unit.Str = fmt.Sprintf("%s %s%s", level.String(), strFields, msg)
+// 文件分隔行(仅文本格式, 避免破坏JSON Lines)
+func (this *logger) banner(line string) {
+	if _, ok := this.encoder.(textEncoder); !ok {
+		return
 	}
-	this.chanMsgs <- unit
-	Threshold(fmt.Sprintf(C_TH_CHAN_OVERLOAD, this.fileName)).Assert(int64(len(this.chanMsgs)))
+	this.fileLogiclogger.Println(line)
+	this.fileLogiclogger.Println() // add space line
 }
 func (this *logger) canLog(lev ELogLevel) bool {
 	if this.status != ELS_Running {
@@ -352,7 +458,7 @@ func (this *logger) loop() {
 		}
 
 		if this.fileLogicHandle != nil {
-			this.fileLogiclogger.Println("··································END··································")
+			this.banner("··································END··································")
 			this.fileLogicHandle.Close()
 		}
 
@@ -369,19 +475,21 @@ func (this *logger) loop() {
 		select {
 		case msg := <-this.chanMsgs:
 			if this.filter(msg) {
+				metDropped.With("filtered").Inc()
 				continue
 			}
 
 			if this.outMode&ELM_Std != 0 || msg.Lv >= ELL_Infos {
-				this.screenLogger.Println(fmt.Sprintf("\x1b[%dm", LOG_MSG_COLORS[msg.Lv]),
-					msg.At.Format("2006-01-02 15:04:05.000"), msg.Str, "\x1b[0m")
+				this.screenLogger.Println(this.encoder.Encode(msg, true))
 			}
 			if this.outMode&ELM_File == 0 {
 				continue
 			}
 			this.fileLogicUpdate()
 
-			this.fileLogiclogger.Println(msg.At.Format("15:04:05.000"), msg.Str)
+			this.fileLogiclogger.Println(this.encoder.Encode(msg, false))
+		case call := <-this.chanCall:
+			call()
 		case <-t.C:
 			if this.fileLogicHandle != nil {
 				this.fileLogicHandle.Sync()
@@ -398,11 +506,10 @@ func (this *logger) loop() {
 					continue
 				}
 				if this.outMode&ELM_Std != 0 || msg.Lv >= ELL_Infos {
-					this.screenLogger.Println(fmt.Sprintf("\x1b[%dm", LOG_MSG_COLORS[msg.Lv]),
-						msg.At.Format("2006-01-02 15:04:05.000"), msg.Str, "\x1b[0m")
+					this.screenLogger.Println(this.encoder.Encode(msg, true))
 				}
 				if this.outMode&ELM_File != 0 {
-					this.fileLogiclogger.Println(msg.At.Format("15:04:05.000") + " " + msg.Str)
+					this.fileLogiclogger.Println(this.encoder.Encode(msg, false))
 				}
 			}
 			return
@@ -410,6 +517,14 @@ func (this *logger) loop() {
 	}
 }
 
+func confDir(dirName string) string {
+	if strings.HasPrefix(dirName, "./") {
+		return dirName
+	}
+	_path, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+	return path.Join(_path, dirName)
+}
+
 func stack(depth int) (file string, line int, fun string) {
 	_pc, _file, _line, ok := runtime.Caller(3 + depth)
 	if !ok {
@@ -1,11 +1,18 @@
 package log
 
+import (
+	"fmt"
+
+	"github.com/cloudapex/ulib/met"
+)
+
 // Main Log
 var main *logger
 
 // Init
 func Init(conf *Config) {
 	main = New(conf).Start()
+	met.OnError(func(err error) { main.Error(1, nil, "%v", err) })
 }
 
 // Term
@@ -15,6 +22,14 @@ func Term() {
 	}
 }
 
+// Reload 热更系统日志配置(目录,文件名,后缀不可热更)
+func Reload(conf *Config) error {
+	if main == nil {
+		return fmt.Errorf("log not init")
+	}
+	return main.Reload(conf)
+}
+
 // Filter 设置日志过滤器
 func Filter(filter func(msg *LogUnit) bool) { main.AddFilter(filter) }
 
@@ -26,6 +41,14 @@ func GetLevel() ELogLevel {
 	return ELL_Infos
 }
 
+// Backlog 获取系统日志消息通道的积压数量与容量
+func Backlog() (size, capy int) {
+	if main != nil {
+		return len(main.chanMsgs), cap(main.chanMsgs)
+	}
+	return 0, 0
+}
+
 // ====================
 
 // 构建字段型日志处理器<一>
@@ -1,6 +1,8 @@
 package mdb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/cloudapex/ulib/ctl"
@@ -15,11 +17,12 @@ import (
 	xlog "xorm.io/xorm/log"
 )
 
-func Controller() IContrler { return &controller{} }
+func Controller(confs ...[]*Config) IContrler { return &controller{Confs: util.DefaultVal(confs)} }
 
 // > mysql-client control
 type controller struct {
 	log.ILoger
+	ctl.AppBind
 	mapEngines map[string]*xorm.Engine
 
 	Confs []*Config
@@ -28,23 +31,34 @@ type controller struct {
 func (this *controller) HandleName() string { return "mdb" }
 
 func (this *controller) HandleInit() {
-	this.ILoger = ctl.Logger(this.HandleName())
-	util.Cast(this.Confs == nil, func() { this.Fatal("conf = nil") }, nil)
+	if err := this.HandleInitE(); err != nil {
+		this.Fatal("init err=%v", err)
+	}
+}
+func (this *controller) HandleInitE() error {
+	this.ILoger = this.App().Logger(this.HandleName())
+	if this.Confs == nil {
+		return fmt.Errorf("conf = nil")
+	}
 
 	this.mapEngines = make(map[string]*xorm.Engine)
+	this.initMetrics()
 
 	this.TraceD(-1, "Start init mysql connect(%d)...", len(this.Confs))
-	defer this.InfoD(-1, "Init mysql connect(%d) done.", len(this.Confs))
 	for _, conf := range this.Confs {
 		if _, ok := this.mapEngines[conf.Name]; ok {
-			this.Fatal("init err=%v", ErrNameRepeated)
+			this.HandleTerm()
+			return ErrNameRepeated
 		}
 		hand, err := newHand(conf)
 		if err != nil {
-			this.Fatal("init err=%v", err)
+			this.HandleTerm()
+			return fmt.Errorf("init engine[%s] err:%v", conf.Name, err)
 		}
 		this.mapEngines[conf.Name] = hand
 	}
+	this.InfoD(-1, "Init mysql connect(%d) done.", len(this.Confs))
+	return nil
 }
 func (this *controller) HandleTerm() {
 	for _, h := range this.mapEngines {
@@ -52,6 +66,47 @@ func (this *controller) HandleTerm() {
 	}
 }
 
+func (this *controller) HandleHealth(ctx context.Context) (string, error) {
+	errs := []error{}
+	for name, h := range this.mapEngines {
+		if err := h.PingContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("engine[%s] ping err:%v", name, err))
+		}
+	}
+	return fmt.Sprintf("engines:%d", len(this.mapEngines)), errors.Join(errs...)
+}
+
+func (this *controller) HandleReload(old, new *ctl.ConfSection) error {
+	confs := []*Config{}
+	if err := new.Decode(&confs); err != nil {
+		return err
+	}
+
+	unsupports, news := []string{}, map[string]bool{}
+	for _, c := range confs {
+		news[c.Name] = true
+		cur, x := this.conf(c.Name), this.mapEngines[c.Name]
+		if cur == nil || x == nil {
+			unsupports = append(unsupports, c.Name+"(add)")
+			continue
+		}
+		if c.Host != cur.Host || c.Store != cur.Store || c.User != cur.User || c.Passwd != cur.Passwd {
+			unsupports = append(unsupports, c.Name+"(connection)")
+		}
+		x.SetMaxIdleConns(int(c.IdleMax))
+		x.SetMaxOpenConns(int(c.OpenMax))
+		x.ShowSQL(c.ShowSql)
+		cur.IdleMax, cur.OpenMax, cur.ShowSql = c.IdleMax, c.OpenMax, c.ShowSql
+	}
+	for name := range this.mapEngines {
+		util.Cast(!news[name], func() { unsupports = append(unsupports, name+"(remove)") }, nil)
+	}
+	if len(unsupports) > 0 {
+		return fmt.Errorf("engines%v can not be reloaded: %w", unsupports, ctl.ErrRestartOnly)
+	}
+	return nil
+}
+
 //  ==================== Functions
 func (this *controller) Use(name string) *xorm.Engine {
 	return this.mapEngines[name]
@@ -67,6 +122,14 @@ func (this *controller) Drop(name string, tbls ...IEntity) error {
 }
 
 // ------------------------------------------------------------------------------
+func (this *controller) conf(name string) *Config {
+	for _, c := range this.Confs {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
 func newHand(conf *Config) (*xorm.Engine, error) {
 	source := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8&parseTime=True&loc=Local",
 		conf.User, conf.Passwd, conf.Host, conf.Store)
@@ -79,6 +142,7 @@ func newHand(conf *Config) (*xorm.Engine, error) {
 	x.SetLogLevel(xlog.LogLevel(mathutil.Max(int(log.GetLevel()-1), 0)))
 
 	if err := x.Ping(); err != nil {
+		x.Close()
 		return nil, err
 	}
 
@@ -89,6 +153,7 @@ func newHand(conf *Config) (*xorm.Engine, error) {
 	//x.SetTableMapper(core.NewPrefixMapper(core.SnakeMapper{}, C_TABLE_PREFIX))
 
 	x.ShowSQL(conf.ShowSql)
+	x.AddHook(&metHook{conf.Name})
 
 	return x, nil
 }
@@ -0,0 +1,61 @@
+package mdb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cloudapex/ulib/ctl"
+
+	"xorm.io/xorm/contexts"
+)
+
+var (
+	metQuery  = ctl.Metrics("mdb").NewHistogram("query_seconds", "SQL execution latency by db and operation.", nil, "db", "op")
+	metErrors = ctl.Metrics("mdb").NewCounter("query_errors_total", "SQL execution errors by db and operation.", "db", "op")
+)
+
+// 连接池统计(sql.DBStats)
+func (this *controller) initMetrics() {
+	m := ctl.Metrics(this.HandleName())
+	open := m.NewGauge("open_connections", "Established connections both in use and idle.", "app", "db")
+	inUse := m.NewGauge("in_use_connections", "Connections currently in use.", "app", "db")
+	idle := m.NewGauge("idle_connections", "Idle connections.", "app", "db")
+	maxOpen := m.NewGauge("max_open_connections", "Maximum number of open connections.", "app", "db")
+	waitCount := m.NewGauge("wait_count", "Total number of connections waited for.", "app", "db")
+	waitSecs := m.NewGauge("wait_seconds", "Total time blocked waiting for a new connection.", "app", "db")
+	app := this.App().Name()
+	this.App().Collect(m, "dbstats", func() {
+		for name, x := range this.mapEngines {
+			s := x.DB().DB.Stats()
+			open.With(app, name).Set(float64(s.OpenConnections))
+			inUse.With(app, name).Set(float64(s.InUse))
+			idle.With(app, name).Set(float64(s.Idle))
+			maxOpen.With(app, name).Set(float64(s.MaxOpenConnections))
+			waitCount.With(app, name).Set(float64(s.WaitCount))
+			waitSecs.With(app, name).Set(s.WaitDuration.Seconds())
+		}
+	})
+}
+
+// > xorm钩子(统计SQL耗时)
+type metHook struct{ db string }
+
+func (h *metHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) { return c.Ctx, nil }
+func (h *metHook) AfterProcess(c *contexts.ContextHook) error {
+	op := sqlOp(c.SQL)
+	metQuery.With(h.db, op).Observe(c.ExecuteTime.Seconds())
+	if c.Err != nil {
+		metErrors.With(h.db, op).Inc()
+	}
+	return nil
+}
+
+// SQL操作类型(首个关键字)
+func sqlOp(sql string) string {
+	word, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	switch op := strings.ToLower(word); op {
+	case "select", "insert", "update", "delete", "replace", "begin", "commit", "rollback":
+		return op
+	}
+	return "other"
+}
@@ -15,11 +15,17 @@ var Ctl IContrler // 默认DB控制器
 
 // 安装控制器
 func Install(confs []*Config) ctl.IControler {
-	c := ctl.Install(&controller{Confs: confs})
+	c := ctl.Install(Controller(confs))
 	util.Cast(Ctl == nil, func() { Ctl = c.(IContrler) }, nil)
 	return Ctl
 }
 
+// 获取指定应用中安装的控制器(未安装则为nil)
+func Of(app *ctl.App) IContrler {
+	c, _ := app.Controler("mdb").(IContrler)
+	return c
+}
+
 // Connector 获取指定连接器(引擎)
 func Connector(dbName string) *xorm.Engine { return Ctl.Use(dbName) }
 
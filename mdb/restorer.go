@@ -0,0 +1,68 @@
+package mdb
+
+import (
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+// TimerRestorer 定时器状态存储(表ulib_timer_state, 不存在时自动创建)
+func TimerRestorer(dbName string) (ctl.ITimerRestorer, error) {
+	if err := CreateTable(&TimerState{dbName: dbName}); err != nil {
+		return nil, err
+	}
+	return &timerRestorer{dbName: dbName}, nil
+}
+
+// > 定时器状态表(以App区分服务, 多个服务可共用一个库)
+type TimerState struct {
+	Id      int64     `xorm:"pk autoincr"`
+	App     string    `xorm:"varchar(64) notnull unique(app_name)"`
+	Name    string    `xorm:"varchar(191) notnull unique(app_name)"`
+	LastAt  int64     `xorm:"notnull default 0"`
+	Updated time.Time `xorm:"updated"`
+
+	dbName string `xorm:"-"`
+}
+
+func (t *TimerState) DBName(e EDB) string { return t.dbName }
+func (t *TimerState) TableName() string   { return "ulib_timer_state" }
+
+type timerRestorer struct {
+	mutex  util.Locker
+	dbName string
+}
+
+func (r *timerRestorer) Load() map[string]int64 {
+	rows := []*TimerState{}
+	if err := MTable(&TimerState{dbName: r.dbName, App: ctl.AppName()}).Find(&rows); err != nil {
+		log.Error("mdb.TimerRestorer[%q] load err:%v", r.dbName, err)
+	}
+
+	mp := make(map[string]int64, len(rows))
+	for _, it := range rows {
+		mp[it.Name] = it.LastAt
+	}
+	return mp
+}
+
+// 不存在则插入, 否则更新(插入冲突说明其他副本已插入, 改为更新)
+func (r *timerRestorer) Save(key string, valAt int64) {
+	defer r.mutex.UnLock(r.mutex.Lock())
+
+	cond := &TimerState{dbName: r.dbName, App: ctl.AppName(), Name: key}
+	upd := &TimerState{LastAt: valAt}
+
+	has, err := MTable(cond).Exist()
+	if err == nil && !has {
+		row := &TimerState{dbName: r.dbName, App: cond.App, Name: key, LastAt: valAt}
+		if _, err = MTable(row).Create(); err == nil {
+			return
+		}
+	}
+	if _, err = MTable(cond).UpdFields(upd, []string{"last_at"}); err != nil {
+		log.Error("mdb.TimerRestorer[%q] save %q err:%v", r.dbName, key, err)
+	}
+}
@@ -0,0 +1,69 @@
+package mdb
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+	"github.com/cloudapex/ulib/util"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(&log.Config{Level: log.ELL_Warns})
+	code := m.Run()
+	log.Term()
+	os.Exit(code)
+}
+
+// 测试库(ULIB_TEST_MYSQL_HOST未设置或不可连接则跳过; 用户默认root, 库默认test)
+func testMysql(t *testing.T) *Config {
+	t.Helper()
+	host := os.Getenv("ULIB_TEST_MYSQL_HOST")
+	if host == "" {
+		t.Skip("ULIB_TEST_MYSQL_HOST not set")
+	}
+	conn, err := net.DialTimeout("tcp", host, time.Second)
+	if err != nil {
+		t.Skipf("mysql %s unavailable: %v", host, err)
+	}
+	conn.Close()
+
+	user, store := os.Getenv("ULIB_TEST_MYSQL_USER"), os.Getenv("ULIB_TEST_MYSQL_STORE")
+	return &Config{Name: "test", Host: host, User: util.Tern(user != "", user, "root"), Passwd: os.Getenv("ULIB_TEST_MYSQL_PASSWD"),
+		Store: util.Tern(store != "", store, "test"), IdleMax: 2, OpenMax: 4}
+}
+
+func TestTimerRestorer(t *testing.T) {
+	conf := testMysql(t)
+	Install([]*Config{conf})
+	if err := ctl.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.Stop()
+
+	r, err := TimerRestorer(conf.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DropTable(&TimerState{dbName: conf.Name})
+	if err := DeleteTable(&TimerState{dbName: conf.Name}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Save("a", 100)
+	r.Save("b", 200)
+	r.Save("a", 300)
+
+	// 新建的存储器(如重启后)可恢复
+	r2, err := TimerRestorer(conf.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := r2.Load()
+	if len(mp) != 2 || mp["a"] != 300 || mp["b"] != 200 {
+		t.Fatalf("unexpected state %v", mp)
+	}
+}
@@ -0,0 +1,27 @@
+package met
+
+const (
+	C_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8" // Prometheus文本格式
+)
+
+// 默认直方图分桶(秒)
+var DefBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// > 指标类型
+type EKind int //
+const (
+	EKind_Counter   EKind = iota + 1 // 计数器(只增)
+	EKind_Gauge                      // 仪表(可增减)
+	EKind_Histogram                  // 直方图
+) //
+func (e EKind) String() string {
+	switch e {
+	case EKind_Counter:
+		return "counter"
+	case EKind_Gauge:
+		return "gauge"
+	case EKind_Histogram:
+		return "histogram"
+	}
+	return "untyped"
+}
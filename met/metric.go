@@ -0,0 +1,134 @@
+package met
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ==================== 指标族(同名指标, 按标签值区分)
+type family struct {
+	name    string
+	help    string
+	kind    EKind
+	labels  []string
+	buckets []float64
+
+	mutex  sync.RWMutex
+	series map[string]*series // 标签值 => 序列
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Errorf("metric[%s] expect %d label values but got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mutex.RLock()
+	s, ok := f.series[key]
+	f.mutex.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if s, ok = f.series[key]; !ok {
+		s = &series{values: append([]string{}, values...)}
+		if f.kind == EKind_Histogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// 按标签值排序的序列
+func (f *family) sorted() []*series {
+	f.mutex.RLock()
+	list := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		list = append(list, s)
+	}
+	f.mutex.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return strings.Join(list[i].values, ",") < strings.Join(list[j].values, ",") })
+	return list
+}
+
+// ==================== 序列
+type series struct {
+	values []string
+	bits   uint64 // float64 bits(counter/gauge值, histogram总和)
+
+	counts []uint64 // histogram各分桶计数(非累计)
+	count  uint64   // histogram观测次数
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&s.bits)
+		if atomic.CompareAndSwapUint64(&s.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+func (s *series) set(v float64)  { atomic.StoreUint64(&s.bits, math.Float64bits(v)) }
+func (s *series) value() float64 { return math.Float64frombits(atomic.LoadUint64(&s.bits)) }
+
+// ==================== Counter
+type CounterVec struct{ f *family }
+
+// 指定标签值的计数器
+func (c *CounterVec) With(values ...string) Counter { return Counter{c.f.with(values)} }
+
+type Counter struct{ s *series }
+
+func (c Counter) Inc() { c.s.add(1) }
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		panic(fmt.Errorf("counter can not decrease"))
+	}
+	c.s.add(v)
+}
+func (c Counter) Value() float64 { return c.s.value() }
+
+// ==================== Gauge
+type GaugeVec struct{ f *family }
+
+// 指定标签值的仪表
+func (g *GaugeVec) With(values ...string) Gauge { return Gauge{g.f.with(values)} }
+
+type Gauge struct{ s *series }
+
+func (g Gauge) Set(v float64)  { g.s.set(v) }
+func (g Gauge) Add(v float64)  { g.s.add(v) }
+func (g Gauge) Inc()           { g.s.add(1) }
+func (g Gauge) Dec()           { g.s.add(-1) }
+func (g Gauge) Value() float64 { return g.s.value() }
+
+// ==================== Histogram
+type HistogramVec struct{ f *family }
+
+// 指定标签值的直方图
+func (h *HistogramVec) With(values ...string) Histogram { return Histogram{h.f, h.f.with(values)} }
+
+type Histogram struct {
+	f *family
+	s *series
+}
+
+func (h Histogram) Observe(v float64) {
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(h.f.buckets) {
+		atomic.AddUint64(&h.s.counts[i], 1)
+	}
+	atomic.AddUint64(&h.s.count, 1)
+	h.s.add(v)
+}
+
+// 观测距离start的耗时(秒)
+func (h Histogram) ObserveSince(start time.Time) { h.Observe(time.Since(start).Seconds()) }
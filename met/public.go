@@ -0,0 +1,72 @@
+// Package met 轻量指标库(counter, gauge, histogram), 以Prometheus文本格式导出
+package met
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 注册计数器(labels:标签名)
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	return Scope("").NewCounter(name, help, labels...)
+}
+
+// 注册仪表
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	return Scope("").NewGauge(name, help, labels...)
+}
+
+// 注册直方图(buckets为空则使用DefBuckets)
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Scope("").NewHistogram(name, help, buckets, labels...)
+}
+
+// 注册采集函数(导出前调用, 用于刷新仪表类指标; 同名覆盖)
+func Collect(name string, fun func()) { Scope("").Collect(name, fun) }
+
+// 设置内部错误(如采集函数panic)的处理函数(默认输出到stderr; log包初始化时接管)
+func OnError(fun func(err error)) { errHandler.Store(&fun) }
+
+// 以Prometheus文本格式输出所有指标
+func Write(w io.Writer) error { return std.write(w) }
+
+// http处理器(Prometheus文本格式)
+func Handler() http.Handler { return handler{} }
+
+// ==================== Scope(以前缀区分的指标命名空间, 如每个控制器一个)
+type Scope string
+
+func (s Scope) NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{std.register(s.name(name), help, EKind_Counter, nil, labels)}
+}
+func (s Scope) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{std.register(s.name(name), help, EKind_Gauge, nil, labels)}
+}
+func (s Scope) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{std.register(s.name(name), help, EKind_Histogram, buckets, labels)}
+}
+func (s Scope) Collect(name string, fun func()) {
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+	std.collectors[s.name(name)] = fun
+}
+
+// 指标全名(prefix_name, 非法字符替换为_)
+func (s Scope) name(name string) string {
+	if s != "" {
+		name = string(s) + "_" + name
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,151 @@
+package met
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	std        = &registry{families: map[string]*family{}, collectors: map[string]func(){}}
+	errHandler atomic.Pointer[func(err error)]
+)
+
+// 报告内部错误
+func report(err error) {
+	if f := errHandler.Load(); f != nil && *f != nil {
+		(*f)(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+// > 注册表
+type registry struct {
+	mutex      sync.RWMutex
+	families   map[string]*family
+	collectors map[string]func() // 导出前调用(刷新仪表类指标)
+}
+
+// 注册指标族(同名同类型则返回已存在的, 以便控制器重复初始化)
+func (r *registry) register(name, help string, kind EKind, buckets []float64, labels []string) *family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || len(f.labels) != len(labels) {
+			panic(fmt.Errorf("metric[%s] already registered as %v%v", name, f.kind, f.labels))
+		}
+		return f
+	}
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*series{}}
+	r.families[name] = f
+	return f
+}
+
+func (r *registry) collect() {
+	r.mutex.RLock()
+	funs := make(map[string]func(), len(r.collectors))
+	for name, f := range r.collectors {
+		funs[name] = f
+	}
+	r.mutex.RUnlock()
+
+	for name, f := range funs {
+		func() {
+			defer func() {
+				if x := recover(); x != nil {
+					report(fmt.Errorf("met collector[%s] panic: %v", name, x))
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+// 以Prometheus文本格式输出
+func (r *registry) write(w io.Writer) error {
+	r.collect()
+
+	r.mutex.RLock()
+	list := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		list = append(list, f)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range list {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escape(f.help, false))
+		fmt.Fprintf(bw, "# TYPE %s %v\n", f.name, f.kind)
+		for _, s := range f.sorted() {
+			if f.kind != EKind_Histogram {
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, labelStr(f.labels, s.values, "", ""), formatFloat(s.value()))
+				continue
+			}
+			var cum uint64
+			for i, le := range f.buckets {
+				cum += atomic.LoadUint64(&s.counts[i])
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, labelStr(f.labels, s.values, "le", formatFloat(le)), cum)
+			}
+			count := atomic.LoadUint64(&s.count)
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, labelStr(f.labels, s.values, "le", "+Inf"), count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, labelStr(f.labels, s.values, "", ""), formatFloat(s.value()))
+			fmt.Fprintf(bw, "%s_count%s %d\n", f.name, labelStr(f.labels, s.values, "", ""), count)
+		}
+	}
+	return bw.Flush()
+}
+
+// --------------------
+func labelStr(names, values []string, extName, extValue string) string {
+	if len(names) == 0 && extName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", n, escape(values[i], true)))
+	}
+	if extName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extName, extValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+func escape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// http处理器
+type handler struct{}
+
+func (handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", C_CONTENT_TYPE)
+	if err := std.write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,76 @@
+package met
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func newRegistry() *registry {
+	return &registry{families: map[string]*family{}, collectors: map[string]func(){}}
+}
+
+func TestWriteExposition(t *testing.T) {
+	r := newRegistry()
+	reqs := &CounterVec{r.register("req_total", "Requests.\nby route", EKind_Counter, nil, []string{"route"})}
+	temp := &GaugeVec{r.register("temp", "Temperature.", EKind_Gauge, nil, nil)}
+	cost := &HistogramVec{r.register("cost_seconds", "Cost.", EKind_Histogram, []float64{0.1, 1}, []string{"op"})}
+
+	reqs.With(`/a"b\c`).Add(2)
+	reqs.With("/").Inc()
+	r.collectors["temp"] = func() { temp.With().Set(math.Inf(1)) }
+	cost.With("get").Observe(0.05)
+	cost.With("get").Observe(0.5)
+	cost.With("get").Observe(5)
+
+	var b strings.Builder
+	if err := r.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	expect := `# HELP cost_seconds Cost.
+# TYPE cost_seconds histogram
+cost_seconds_bucket{op="get",le="0.1"} 1
+cost_seconds_bucket{op="get",le="1"} 2
+cost_seconds_bucket{op="get",le="+Inf"} 3
+cost_seconds_sum{op="get"} 5.55
+cost_seconds_count{op="get"} 3
+# HELP req_total Requests.\nby route
+# TYPE req_total counter
+req_total{route="/"} 1
+req_total{route="/a\"b\\c"} 2
+# HELP temp Temperature.
+# TYPE temp gauge
+temp +Inf
+`
+	if b.String() != expect {
+		t.Fatalf("unexpected exposition:\n%s\nexpect:\n%s", b.String(), expect)
+	}
+}
+
+func TestWriteCollectorPanic(t *testing.T) {
+	r := newRegistry()
+	ups := &GaugeVec{r.register("up", "Up.", EKind_Gauge, nil, nil)}
+	r.collectors["bad"] = func() { panic("boom") }
+	r.collectors["up"] = func() { ups.With().Set(1) }
+
+	var reported error
+	OnError(func(err error) { reported = err })
+	defer OnError(nil)
+
+	var b strings.Builder
+	if err := r.write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if reported == nil || !strings.Contains(reported.Error(), "met collector[bad] panic") {
+		t.Fatalf("collector panic should be reported, got %v", reported)
+	}
+	if !strings.Contains(b.String(), "\nup 1\n") {
+		t.Fatalf("other collectors should still run, got:\n%s", b.String())
+	}
+}
+
+func TestScopeName(t *testing.T) {
+	if n := Scope("htp").name("req-total.x"); n != "htp_req_total_x" {
+		t.Fatalf("unexpected name %q", n)
+	}
+}
@@ -1,6 +1,8 @@
 package rdb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -18,7 +20,9 @@ func Controller(confs []*Config) IContrler { return &controller{Confs: confs} }
 // > redis-client controller
 type controller struct {
 	log.ILoger
+	ctl.AppBind
 
+	mutex util.RWLocker
 	pools map[string]IPooler
 
 	Confs []*Config
@@ -27,17 +31,24 @@ type controller struct {
 func (this *controller) HandleName() string { return "rdb" }
 
 func (this *controller) HandleInit() {
-	this.ILoger = ctl.Logger(this.HandleName())
-	util.Cast(len(this.Confs) == 0, func() { this.Fatal("conf = nil") }, nil)
+	if err := this.HandleInitE(); err != nil {
+		this.Fatalv(err)
+	}
+}
+func (this *controller) HandleInitE() error {
+	this.ILoger = this.App().Logger(this.HandleName())
+	if len(this.Confs) == 0 {
+		return fmt.Errorf("conf = nil")
+	}
 
 	this.pools = make(map[string]IPooler)
+	this.initMetrics()
 
 	this.TraceD(-1, "Start init redis conn pool(%d)...", len(this.Confs))
-	defer this.InfoD(-1, "Init redis conn pool(%d) done.", len(this.Confs))
-
 	for _, conf := range this.Confs {
 		if _, ok := this.pools[conf.Name]; ok {
-			this.Fatalv(ErrNameRepeated)
+			this.HandleTerm()
+			return ErrNameRepeated
 		}
 		var err error
 		var pool IPooler
@@ -47,23 +58,81 @@ func (this *controller) HandleInit() {
 			pool, err = newNormalPool(conf)
 		}
 		if err != nil {
-			this.Fatalv(err)
+			this.HandleTerm()
+			return fmt.Errorf("init pool[%s] err:%v", conf.Name, err)
 		}
 
 		this.pools[conf.Name] = pool
 	}
+	this.InfoD(-1, "Init redis conn pool(%d) done.", len(this.Confs))
+	return nil
 }
 
 func (this *controller) HandleTerm() {
-	for _, p := range this.pools {
+	for _, p := range this.poolList() {
 		p.Close()
 	}
 }
 
+func (this *controller) HandleHealth(ctx context.Context) (string, error) {
+	errs, pools := []error{}, this.poolList()
+	for name, p := range pools {
+		if err := ping(p); err != nil {
+			errs = append(errs, fmt.Errorf("pool[%s] ping err:%v", name, err))
+		}
+	}
+	return fmt.Sprintf("pools:%d", len(pools)), errors.Join(errs...)
+}
+
+func (this *controller) HandleReload(old, new *ctl.ConfSection) error {
+	confs := []*Config{}
+	if err := new.Decode(&confs); err != nil {
+		return err
+	}
+
+	unsupports, news, pools := []string{}, map[string]bool{}, this.poolList()
+	for _, c := range confs {
+		news[c.Name] = true
+		cur, p := this.conf(c.Name), pools[c.Name]
+		if cur == nil || p == nil {
+			unsupports = append(unsupports, c.Name+"(add)")
+			continue
+		}
+		if c.Addr != cur.Addr || c.DbIdx != cur.DbIdx || c.Passwd != cur.Passwd {
+			unsupports = append(unsupports, c.Name+"(connection)")
+			continue
+		}
+		if c.MaxIdle == cur.MaxIdle && c.MaxActive == cur.MaxActive && c.Wait == cur.Wait {
+			continue
+		}
+		if _, ok := p.(*ClusterPool); ok { // 节点连接池由redisc持有, 需重启生效
+			unsupports = append(unsupports, c.Name+"(cluster limits)")
+			continue
+		}
+		// 运行中的redis.Pool字段不可并发修改, 新建连接池替换后关闭旧池(借出的连接归还时关闭)
+		np, err := newNormalPool(c)
+		if err != nil {
+			unsupports = append(unsupports, fmt.Sprintf("%s(%v)", c.Name, err))
+			continue
+		}
+		this.swapPool(c.Name, np)
+		p.Close()
+		cur.MaxIdle, cur.MaxActive, cur.Wait = c.MaxIdle, c.MaxActive, c.Wait
+	}
+	for name := range pools {
+		util.Cast(!news[name], func() { unsupports = append(unsupports, name+"(remove)") }, nil)
+	}
+	if len(unsupports) > 0 {
+		return fmt.Errorf("pools%v can not be reloaded: %w", unsupports, ctl.ErrRestartOnly)
+	}
+	return nil
+}
+
 //  ==================== Functions
 
 // Use 选择连接池
 func (this *controller) Use(name string) IPooler {
+	defer this.mutex.RUnLock(this.mutex.RLock())
 	if it, ok := this.pools[C_DB_CLUSTER]; ok {
 		return it
 	}
@@ -71,6 +140,35 @@ func (this *controller) Use(name string) IPooler {
 }
 
 // ------------------------------------------------------------------------------
+func (this *controller) poolList() map[string]IPooler {
+	defer this.mutex.RUnLock(this.mutex.RLock())
+	pools := make(map[string]IPooler, len(this.pools))
+	for name, p := range this.pools {
+		pools[name] = p
+	}
+	return pools
+}
+func (this *controller) swapPool(name string, p IPooler) {
+	defer this.mutex.UnLock(this.mutex.Lock())
+	this.pools[name] = p
+}
+func (this *controller) conf(name string) *Config {
+	for _, c := range this.Confs {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+func ping(p IPooler) error {
+	c := p.Get()
+	defer c.Close()
+	if err := c.Err(); err != nil {
+		return err
+	}
+	_, err := c.Do("PING")
+	return err
+}
 func newNormalPool(conf *Config) (IPooler, error) {
 	p := &NormalPool{redis.Pool{
 		MaxIdle:     int(conf.MaxIdle),
@@ -0,0 +1,109 @@
+package rdb
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	metCommand = ctl.Metrics("rdb").NewHistogram("command_seconds", "Redis command latency by db and command.", nil, "db", "command")
+	metErrors  = ctl.Metrics("rdb").NewCounter("command_errors_total", "Redis command errors(except nil) by db and command.", "db", "command")
+)
+
+// 连接池统计
+func (this *controller) initMetrics() {
+	m := ctl.Metrics(this.HandleName())
+	active := m.NewGauge("pool_active_connections", "Connections in the pool(idle and in use).", "app", "db", "addr")
+	idle := m.NewGauge("pool_idle_connections", "Idle connections in the pool.", "app", "db", "addr")
+	app := this.App().Name()
+	this.App().Collect(m, "pool", func() {
+		for name, p := range this.poolList() {
+			switch it := p.(type) {
+			case *NormalPool:
+				s := it.Stats()
+				active.With(app, name, "").Set(float64(s.ActiveCount))
+				idle.With(app, name, "").Set(float64(s.IdleCount))
+			case *ClusterPool:
+				for addr, s := range it.Stats() {
+					active.With(app, name, addr).Set(float64(s.ActiveCount))
+					idle.With(app, name, addr).Set(float64(s.IdleCount))
+				}
+			}
+		}
+	})
+}
+
+// > 统计命令耗时的连接(Do/Send/Receive, 保留ConnWithTimeout)
+type metConn struct {
+	redis.Conn
+	db      string
+	pending []metCmd // 已Send未Receive的命令(FIFO)
+}
+type metCmd struct {
+	cmd   string
+	start time.Time
+}
+
+var _ redis.ConnWithTimeout = (*metConn)(nil)
+
+func (c *metConn) Do(command string, args ...interface{}) (interface{}, error) {
+	return c.do(command, func() (interface{}, error) { return c.Conn.Do(command, args...) })
+}
+func (c *metConn) DoWithTimeout(timeout time.Duration, command string, args ...interface{}) (interface{}, error) {
+	return c.do(command, func() (interface{}, error) { return redis.DoWithTimeout(c.Conn, timeout, command, args...) })
+}
+func (c *metConn) Send(command string, args ...interface{}) error {
+	err := c.Conn.Send(command, args...)
+	if err != nil {
+		metErrors.With(c.db, strings.ToLower(command)).Inc()
+		return err
+	}
+	c.pending = append(c.pending, metCmd{strings.ToLower(command), time.Now()})
+	return nil
+}
+func (c *metConn) Receive() (interface{}, error) {
+	return c.receive(func() (interface{}, error) { return c.Conn.Receive() })
+}
+func (c *metConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.receive(func() (interface{}, error) { return redis.ReceiveWithTimeout(c.Conn, timeout) })
+}
+
+// Do会先Flush并读取所有已Send命令的回复
+func (c *metConn) do(command string, fun func() (interface{}, error)) (interface{}, error) {
+	start := time.Now()
+	r, err := fun()
+
+	for _, it := range c.pending {
+		metCommand.With(c.db, it.cmd).ObserveSince(it.start)
+	}
+	c.pending = c.pending[:0]
+	if command == "" { // 仅flush
+		return r, err
+	}
+
+	cmd := strings.ToLower(command)
+	metCommand.With(c.db, cmd).ObserveSince(start)
+	if err != nil && err != redis.ErrNil {
+		metErrors.With(c.db, cmd).Inc()
+	}
+	return r, err
+}
+
+// 订阅消息等无对应Send的回复不统计
+func (c *metConn) receive(fun func() (interface{}, error)) (interface{}, error) {
+	r, err := fun()
+	if len(c.pending) == 0 {
+		return r, err
+	}
+	it := c.pending[0]
+	c.pending = c.pending[1:]
+	metCommand.With(c.db, it.cmd).ObserveSince(it.start)
+	if err != nil && err != redis.ErrNil {
+		metErrors.With(c.db, it.cmd).Inc()
+	}
+	return r, err
+}
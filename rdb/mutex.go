@@ -2,6 +2,9 @@ package rdb
 
 import (
 	"sync"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
 
 	"github.com/go-redsync/redsync"
 )
@@ -15,6 +18,17 @@ func Mutex(dbName, key string) IMutexer {
 	return redSync(dbName).NewMutex(key)
 }
 
+// TimerLocker 定时任务分布式锁(多副本下同一次触发仅一个副本执行)
+func TimerLocker(dbName string) ctl.ITimerLocker { return &timerLocker{dbName} }
+
+type timerLocker struct {
+	dbName string
+}
+
+func (l *timerLocker) TryLock(key string, ttl time.Duration) bool {
+	return redSync(l.dbName).NewMutex(key, redsync.SetExpiry(ttl), redsync.SetTries(1)).Lock() == nil
+}
+
 //  --------------------
 func redSync(dbName string) *redsync.Redsync {
 	mutex.RLock()
@@ -23,17 +23,29 @@ func Install(confs []*Config) ctl.IControler {
 	return Ctl
 }
 
+// 获取指定应用中安装的控制器(未安装则为nil)
+func Of(app *ctl.App) IContrler {
+	c, _ := app.Controler("rdb").(IContrler)
+	return c
+}
+
 // Pool 获取指定pool
-func Pool(dbName string) IPooler { return Ctl.Use(dbName) }
+func Pool(dbName string) IPooler {
+	if Ctl == nil {
+		log.Error("rdb not installed, pool[%q] unavailable", dbName)
+		return nil
+	}
+	return Ctl.Use(dbName)
+}
 
 // Connector 获取指定pool的连接 !!!注意释放!!!
 func Connector(dbName string) redis.Conn {
-	p := Ctl.Use(dbName)
+	p := Pool(dbName)
 	if p == nil {
 		log.Error("rdb.pool[%q] not found", dbName)
 		return nil
 	}
-	return p.Get()
+	return &metConn{Conn: p.Get(), db: dbName}
 }
 
 // RegistCoder 注册编解码器
@@ -0,0 +1,36 @@
+package rdb
+
+import (
+	"fmt"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+)
+
+// TimerRestorer 定时器状态存储(Hash: ulib:timer:{AppName}:last, field为任务名)
+func TimerRestorer(dbName string) ctl.ITimerRestorer { return &timerRestorer{dbName} }
+
+type timerRestorer struct {
+	dbName string
+}
+
+func (r *timerRestorer) Load() map[string]int64 {
+	mp, err := r.hash().GetAll().Int64Map()
+	if err != nil {
+		log.Error("rdb.TimerRestorer[%q] load err:%v", r.dbName, err)
+		return map[string]int64{}
+	}
+	return mp
+}
+
+// 单字段hset, 并发Save互不覆盖
+func (r *timerRestorer) Save(key string, valAt int64) {
+	if err := r.hash().Set(key, valAt).Error(); err != nil {
+		log.Error("rdb.TimerRestorer[%q] save %q err:%v", r.dbName, key, err)
+	}
+}
+
+// 以AppName区分服务, 多个服务可共用一个redis
+func (r *timerRestorer) hash() *Hash {
+	return &Hash{Key{DB: r.dbName, K: fmt.Sprintf("ulib:timer:%s:last", ctl.AppName())}}
+}
@@ -0,0 +1,76 @@
+package rdb
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/ulib/ctl"
+	"github.com/cloudapex/ulib/log"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(&log.Config{Level: log.ELL_Warns})
+	code := m.Run()
+	log.Term()
+	os.Exit(code)
+}
+
+// 启动临时redis-server(不存在则跳过)
+func startRedis(t *testing.T) string {
+	t.Helper()
+	bin, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not found")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cmd := exec.Command(bin, "--port", fmt.Sprint(port), "--bind", "127.0.0.1", "--save", "", "--appendonly", "no")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if conn, err := redis.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return addr
+		}
+	}
+	t.Fatal("redis-server not ready")
+	return ""
+}
+
+func TestTimerRestorer(t *testing.T) {
+	addr := startRedis(t)
+	Install([]*Config{{Name: "test", Addr: addr, MaxIdle: 2, MaxActive: 8}})
+	if err := ctl.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.Stop()
+
+	r := TimerRestorer("test")
+	if mp := r.Load(); len(mp) != 0 {
+		t.Fatalf("expect empty state, got %v", mp)
+	}
+	r.Save("a", 100)
+	r.Save("b", 200)
+	r.Save("a", 300)
+
+	// 新建的存储器(如重启后)可恢复
+	mp := TimerRestorer("test").Load()
+	if len(mp) != 2 || mp["a"] != 300 || mp["b"] != 200 {
+		t.Fatalf("unexpected state %v", mp)
+	}
+}
@@ -21,45 +21,153 @@ import (
 
 var (
 	chanSig     = make(chan os.Signal, 1)
-	chanExit    = make(chan int)
+	chanQuit    = make(chan quitReq, 1)
+	chanExit    = make(chan int) // 退出处理完成后关闭
+	chanWaited  = make(chan int) // 有等待者接收到退出后关闭
+	onceWaited  sync.Once
+	exitCode    int
 	termHandles = []func(interface{}){}
+
+	sigLock    sync.Mutex
+	termSigs   = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, os.Interrupt} // 触发退出的信号
+	sigHandles = map[os.Signal]func(os.Signal){}                                             // 不触发退出的信号钩子
+	notifieds  = map[os.Signal]bool{}                                                        // 已监听的信号(=>是否为退出信号)
 )
 
+// 退出请求
+type quitReq struct {
+	code   int
+	reason interface{}
+}
+
 func init() {
 	rand.Seed(uint64(time.Now().UnixNano()))
-	signal.Notify(chanSig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, os.Interrupt)
+	notifySignals()
 	Term(func(reason interface{}) { log.Term() })
 	go func() {
-		c := <-chanSig
+		var q quitReq
+		for quit := false; !quit; {
+			select {
+			case sig := <-chanSig:
+				if h, term := signalHandle(sig); !term {
+					Cast(h != nil, func() { Goroutine(fmt.Sprintf("signal[%v]", sig), func() { h(sig) }) }, nil)
+					continue
+				}
+				q, quit = quitReq{0, sig}, true
+			case q = <-chanQuit:
+				quit = true
+			}
+		}
+
 		for i := len(termHandles) - 1; i >= 0; i-- {
-			termHandles[i](c)
+			termHandles[i](q.reason)
 		}
 
-		exitCode := 0
+		// 等待者接手退出, 1秒内没有则直接退出
+		exitCode = q.code
+		close(chanExit)
 		select {
-		case chanExit <- exitCode:
-			return
+		case <-chanWaited:
 		case <-time.After(time.Second * 1):
-			os.Exit(exitCode)
+			os.Exit(q.code)
 		}
 	}()
 }
 
-func Wait(x ...interface{}) {
+// 等待退出(返回退出码)
+func Wait(x ...interface{}) int {
 	<-chanExit
+	onceWaited.Do(func() { close(chanWaited) })
+	return exitCode
 }
 func Term(clearHand func(interface{})) {
 	termHandles = append(termHandles, clearHand)
 }
-func Quit(delay ...time.Duration) {
+
+// 正常退出(退出码0)
+func Quit(delay ...time.Duration) { QuitCode(0, nil, delay...) }
+
+// 以指定退出码退出(reason传递给Term注册的处理函数)
+func QuitCode(code int, reason interface{}, delay ...time.Duration) {
 	go func() {
 		if len(delay) > 0 && delay[0] > 0 {
 			<-time.After(delay[0])
 		}
-		close(chanSig)
+		select {
+		case chanQuit <- quitReq{code, Tern[bool, interface{}](reason != nil, reason, "quit")}:
+		default: // 已在退出中
+		}
 	}()
 }
 
+// 设置触发退出的信号(默认SIGINT SIGTERM SIGQUIT)
+func TermSignals(sigs ...os.Signal) {
+	sigLock.Lock()
+	termSigs = append([]os.Signal{}, sigs...)
+	sigLock.Unlock()
+	notifySignals()
+}
+
+// 注册不触发退出的信号钩子(如SIGHUP SIGUSR1 SIGUSR2; fun为nil则移除)
+func OnSignal(sig os.Signal, fun func(os.Signal)) {
+	sigLock.Lock()
+	if fun == nil {
+		delete(sigHandles, sig)
+	} else {
+		sigHandles[sig] = fun
+	}
+	sigLock.Unlock()
+	notifySignals()
+}
+
+// 信号钩子(退出信号优先)
+func signalHandle(sig os.Signal) (hook func(os.Signal), term bool) {
+	sigLock.Lock()
+	defer sigLock.Unlock()
+	for _, it := range termSigs {
+		if it == sig {
+			return nil, true
+		}
+	}
+	return sigHandles[sig], false
+}
+
+// 增量更新监听的信号(先监听新增的再停止移除的, 避免Stop与Notify之间丢失信号)
+// 移除的退出信号恢复系统默认行为; 移除的钩子信号(如默认捕获的SIGHUP)改为忽略, 避免收到后按默认行为终止进程
+func notifySignals() {
+	sigLock.Lock()
+	defer sigLock.Unlock()
+
+	wants := map[os.Signal]bool{} // 信号 => 是否为退出信号
+	for sig := range sigHandles {
+		wants[sig] = false
+	}
+	for _, sig := range termSigs {
+		wants[sig] = true
+	}
+
+	adds, resets, ignores := []os.Signal{}, []os.Signal{}, []os.Signal{}
+	for sig := range wants {
+		_, ok := notifieds[sig]
+		Cast(!ok, func() { adds = append(adds, sig) }, nil)
+	}
+	for sig, term := range notifieds {
+		if _, ok := wants[sig]; !ok {
+			Cast(term, func() { resets = append(resets, sig) }, func() { ignores = append(ignores, sig) })
+		}
+	}
+	if len(adds) > 0 { // 空列表表示所有信号
+		signal.Notify(chanSig, adds...)
+	}
+	if len(resets) > 0 { // 同上
+		signal.Reset(resets...)
+	}
+	if len(ignores) > 0 { // 同上
+		signal.Ignore(ignores...)
+	}
+	notifieds = wants
+}
+
 func GoId() (int, error) {
 	var buf [64]byte
 	idField := strings.Fields(strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine "))[0]
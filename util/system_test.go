@@ -0,0 +1,79 @@
+package util
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalHandle(t *testing.T) {
+	defer TermSignals(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, os.Interrupt)
+
+	hooked := func(os.Signal) {}
+	OnSignal(syscall.SIGHUP, hooked)
+	defer OnSignal(syscall.SIGHUP, nil)
+
+	if _, term := signalHandle(syscall.SIGTERM); !term {
+		t.Fatal("SIGTERM should terminate by default")
+	}
+	if h, term := signalHandle(syscall.SIGHUP); term || h == nil {
+		t.Fatal("SIGHUP should call the hook without terminating")
+	}
+	if h, term := signalHandle(syscall.SIGALRM); term || h != nil {
+		t.Fatal("unregistered signal should be neither hooked nor terminating")
+	}
+
+	// 退出信号优先于钩子
+	TermSignals(syscall.SIGHUP)
+	if _, term := signalHandle(syscall.SIGHUP); !term {
+		t.Fatal("term signal should take precedence over hook")
+	}
+	if _, term := signalHandle(syscall.SIGTERM); term {
+		t.Fatal("SIGTERM should no longer terminate")
+	}
+}
+
+// 移除钩子后信号被忽略(不按默认行为终止进程)
+func TestSignalRemovedIgnored(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported")
+	}
+	got := make(chan os.Signal, 1)
+	OnSignal(syscall.SIGHUP, func(sig os.Signal) { got <- sig })
+
+	self, _ := os.FindProcess(os.Getpid())
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("hook not called")
+	}
+
+	OnSignal(syscall.SIGHUP, nil)
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // 未忽略则进程已被终止
+}
+
+// 退出码与原因传递给等待者和Term处理函数(需最后执行: 退出后不可恢复)
+func TestQuitCode(t *testing.T) {
+	reasons := make(chan interface{}, 1)
+	Term(func(reason interface{}) { reasons <- reason })
+
+	QuitCode(3, "fatal")
+	if code := Wait(); code != 3 {
+		t.Fatalf("expect exit code 3, got %d", code)
+	}
+	if reason := <-reasons; reason != "fatal" {
+		t.Fatalf("expect reason fatal, got %v", reason)
+	}
+	QuitCode(4, nil) // 已在退出中, 忽略
+	if code := Wait(); code != 3 {
+		t.Fatalf("exit code should not change, got %d", code)
+	}
+}
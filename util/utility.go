@@ -1,5 +1,7 @@
 package util
 
+import "time"
+
 func Args(params ...interface{}) []interface{} { return params }
 
 func Tern[T bool, U any](isTrue T, ifValue U, elseValue U) U {
@@ -22,6 +24,18 @@ func Cast(condition bool, trueFun, falseFun func()) {
 	}
 }
 
+// 指数退避间隔: base<<attempt, 不超过limit(不会溢出)
+func Backoff(base time.Duration, attempt int, limit time.Duration) time.Duration {
+	d := base
+	for i := 0; i < attempt; i++ {
+		if d >= limit/2 {
+			return limit
+		}
+		d *= 2
+	}
+	return min(d, limit)
+}
+
 func DefaultVal[T any](vars []T) T {
 	var zero T
 	if len(vars) > 0 {